@@ -0,0 +1,111 @@
+// Package apiloader provides a document loader for paginated HTTP APIs. It
+// is meant as a base for SaaS connectors (Notion, Confluence, ...) that only
+// need to supply a function fetching a single page.
+package apiloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/averikitsch/langchaingo/documentloaders"
+	"github.com/averikitsch/langchaingo/schema"
+	"github.com/averikitsch/langchaingo/textsplitter"
+)
+
+// ErrCursorLoop is returned when a fetch returns the cursor it was called
+// with, which would otherwise page forever.
+var ErrCursorLoop = errors.New("fetch returned the same cursor it was called with")
+
+// Item is a single record returned by the API.
+type Item struct {
+	Content  string
+	Metadata map[string]any
+}
+
+// Page is a page of items. An empty NextCursor marks the last page.
+type Page struct {
+	Items      []Item
+	NextCursor string
+}
+
+// FetchFunc fetches the page identified by cursor. The first page is
+// requested with an empty cursor.
+type FetchFunc func(ctx context.Context, cursor string) (Page, error)
+
+// Loader loads documents from every page of a paginated API.
+type Loader struct {
+	fetch    FetchFunc
+	maxPages int
+}
+
+var _ documentloaders.Loader = &Loader{}
+
+// Option is a function that configures a Loader.
+type Option func(*Loader)
+
+// WithMaxPages limits the number of pages fetched. The default of zero
+// fetches every page.
+func WithMaxPages(maxPages int) Option {
+	return func(l *Loader) {
+		l.maxPages = maxPages
+	}
+}
+
+// New creates a Loader that pages through the API with fetch.
+func New(fetch FetchFunc, opts ...Option) *Loader {
+	l := &Loader{fetch: fetch}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Load fetches every page and returns one document per item. Each document
+// carries the item metadata plus the zero-based "page" it was fetched from.
+func (l *Loader) Load(ctx context.Context) ([]schema.Document, error) {
+	if l.fetch == nil {
+		return nil, errors.New("missing fetch function")
+	}
+
+	var docs []schema.Document
+	cursor := ""
+	for page := 0; l.maxPages <= 0 || page < l.maxPages; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p, err := l.fetch(ctx, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch page %d: %w", page, err)
+		}
+		for _, item := range p.Items {
+			metadata := make(map[string]any, len(item.Metadata)+1)
+			for k, v := range item.Metadata {
+				metadata[k] = v
+			}
+			metadata["page"] = page
+			docs = append(docs, schema.Document{
+				PageContent: item.Content,
+				Metadata:    metadata,
+			})
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		if p.NextCursor == cursor {
+			return nil, fmt.Errorf("%w: %q", ErrCursorLoop, cursor)
+		}
+		cursor = p.NextCursor
+	}
+	return docs, nil
+}
+
+// LoadAndSplit fetches every page and splits the documents using a text
+// splitter.
+func (l *Loader) LoadAndSplit(ctx context.Context, splitter textsplitter.TextSplitter) ([]schema.Document, error) {
+	docs, err := l.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return textsplitter.SplitDocuments(splitter, docs)
+}
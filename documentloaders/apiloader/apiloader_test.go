@@ -0,0 +1,76 @@
+package apiloader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePaginator serves pages keyed by cursor.
+func fakePaginator(pages map[string]Page) FetchFunc {
+	return func(_ context.Context, cursor string) (Page, error) {
+		p, ok := pages[cursor]
+		if !ok {
+			return Page{}, fmt.Errorf("unknown cursor %q", cursor)
+		}
+		return p, nil
+	}
+}
+
+func threePages() map[string]Page {
+	return map[string]Page{
+		"": {
+			Items: []Item{
+				{Content: "a", Metadata: map[string]any{"id": 1}},
+				{Content: "b", Metadata: map[string]any{"id": 2}},
+			},
+			NextCursor: "c1",
+		},
+		"c1": {
+			Items:      []Item{{Content: "c", Metadata: map[string]any{"id": 3}}},
+			NextCursor: "c2",
+		},
+		"c2": {
+			Items: []Item{{Content: "d", Metadata: map[string]any{"id": 4}}},
+		},
+	}
+}
+
+func TestLoadAllPages(t *testing.T) {
+	t.Parallel()
+	docs, err := New(fakePaginator(threePages())).Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, docs, 4)
+
+	contents := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		contents = append(contents, doc.PageContent)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, contents)
+	assert.Equal(t, map[string]any{"id": 3, "page": 1}, docs[2].Metadata)
+	assert.Equal(t, map[string]any{"id": 4, "page": 2}, docs[3].Metadata)
+}
+
+func TestLoadMaxPages(t *testing.T) {
+	t.Parallel()
+	docs, err := New(fakePaginator(threePages()), WithMaxPages(2)).Load(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, docs, 3)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+	loop := fakePaginator(map[string]Page{
+		"":   {NextCursor: "c1"},
+		"c1": {NextCursor: "c1"},
+	})
+	_, err := New(loop).Load(context.Background())
+	require.ErrorIs(t, err, ErrCursorLoop)
+
+	broken := fakePaginator(map[string]Page{"": {NextCursor: "missing"}})
+	_, err = New(broken).Load(context.Background())
+	require.ErrorContains(t, err, "failed to fetch page 1")
+}
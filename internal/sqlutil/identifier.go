@@ -0,0 +1,73 @@
+// Package sqlutil contains helpers shared by the Postgres backed memory and
+// vector store packages.
+package sqlutil
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the maximum length in bytes of a Postgres
+// identifier (NAMEDATALEN - 1).
+const maxIdentifierLength = 63
+
+// ErrInvalidIdentifier is returned when an identifier can not be safely used
+// in a SQL statement.
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+var simpleIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateIdentifier checks that ident can be used as a quoted Postgres
+// identifier.
+func ValidateIdentifier(ident string) error {
+	switch {
+	case ident == "":
+		return fmt.Errorf("%w: identifier must not be empty", ErrInvalidIdentifier)
+	case len(ident) > maxIdentifierLength:
+		return fmt.Errorf("%w: identifier %q exceeds %d bytes", ErrInvalidIdentifier, ident, maxIdentifierLength)
+	case !utf8.ValidString(ident):
+		return fmt.Errorf("%w: identifier %q is not valid UTF-8", ErrInvalidIdentifier, ident)
+	case strings.ContainsRune(ident, 0):
+		return fmt.Errorf("%w: identifier %q contains a NUL character", ErrInvalidIdentifier, ident)
+	}
+	return nil
+}
+
+// ValidateSimpleIdentifier checks that ident is a plain identifier made of
+// letters, digits and underscores, so it can be interpolated into a statement
+// without quoting.
+func ValidateSimpleIdentifier(ident string) error {
+	if err := ValidateIdentifier(ident); err != nil {
+		return err
+	}
+	if !simpleIdentifierRegexp.MatchString(ident) {
+		return fmt.Errorf("%w: %q must match %s", ErrInvalidIdentifier, ident, simpleIdentifierRegexp)
+	}
+	return nil
+}
+
+// QuoteIdentifier validates ident and returns it as a double quoted Postgres
+// identifier, so reserved words and special characters are handled safely.
+func QuoteIdentifier(ident string) (string, error) {
+	if err := ValidateIdentifier(ident); err != nil {
+		return "", err
+	}
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`, nil
+}
+
+// QuoteQualifiedIdentifier returns the quoted "schema"."name" form of a
+// schema qualified identifier.
+func QuoteQualifiedIdentifier(schemaName, name string) (string, error) {
+	quotedSchema, err := QuoteIdentifier(schemaName)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema name: %w", err)
+	}
+	quotedName, err := QuoteIdentifier(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid name: %w", err)
+	}
+	return quotedSchema + "." + quotedName, nil
+}
@@ -0,0 +1,59 @@
+package sqlutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		ident    string
+		expected string
+		err      bool
+	}{
+		{ident: "order", expected: `"order"`},
+		{ident: "chat_history", expected: `"chat_history"`},
+		{ident: "My Table", expected: `"My Table"`},
+		{ident: `weird"name`, expected: `"weird""name"`},
+		{ident: "", err: true},
+		{ident: strings.Repeat("a", 64), err: true},
+		{ident: "bad\x00name", err: true},
+	}
+
+	for _, tc := range cases {
+		quoted, err := QuoteIdentifier(tc.ident)
+		if tc.err {
+			require.ErrorIs(t, err, ErrInvalidIdentifier)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, quoted)
+	}
+}
+
+func TestQuoteQualifiedIdentifier(t *testing.T) {
+	t.Parallel()
+
+	quoted, err := QuoteQualifiedIdentifier("public", "order")
+	require.NoError(t, err)
+	assert.Equal(t, `"public"."order"`, quoted)
+
+	_, err = QuoteQualifiedIdentifier("", "order")
+	require.ErrorIs(t, err, ErrInvalidIdentifier)
+}
+
+func TestValidateSimpleIdentifier(t *testing.T) {
+	t.Parallel()
+
+	for _, ident := range []string{"my_index", "_index1", "MyTable"} {
+		require.NoError(t, ValidateSimpleIdentifier(ident))
+	}
+	for _, ident := range []string{"", "foo; DROP TABLE bar", "1index", "my-index", `my"index`, strings.Repeat("a", 64)} {
+		require.ErrorIs(t, ValidateSimpleIdentifier(ident), ErrInvalidIdentifier, ident)
+	}
+}
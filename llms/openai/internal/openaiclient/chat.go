@@ -78,6 +78,9 @@ type ChatRequest struct {
 
 	// Metadata allows you to specify additional information that will be passed to the model.
 	Metadata map[string]any `json:"metadata,omitempty"`
+
+	// BaseURL overrides the client's base URL for this request when set.
+	BaseURL string `json:"-"`
 }
 
 // ToolType is the type of a tool.
@@ -399,7 +402,7 @@ func (c *Client) createChat(ctx context.Context, payload *ChatRequest) (*ChatCom
 
 	// Build request
 	body := bytes.NewReader(payloadBytes)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.buildURL("/chat/completions", payload.Model), body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.buildURLWithBase(payload.BaseURL, "/chat/completions", payload.Model), body)
 	if err != nil {
 		return nil, err
 	}
@@ -485,6 +488,10 @@ func combineStreamingChatResponse(
 			return nil, streamResponse.Error
 		}
 
+		if streamResponse.SystemFingerprint != "" {
+			response.SystemFingerprint = streamResponse.SystemFingerprint
+		}
+
 		if streamResponse.Usage != nil {
 			response.Usage.CompletionTokens = streamResponse.Usage.CompletionTokens
 			response.Usage.PromptTokens = streamResponse.Usage.PromptTokens
@@ -0,0 +1,74 @@
+package openaiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ModerationRequest is a request to classify texts with the moderations API.
+type ModerationRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+// ModerationResult is the classification of one moderated input.
+type ModerationResult struct {
+	// Flagged reports whether any category was flagged.
+	Flagged bool `json:"flagged"`
+	// Categories reports by category name, such as "hate" or
+	// "self-harm/intent", whether the input was flagged for it.
+	Categories map[string]bool `json:"categories"`
+	// CategoryScores holds the model's confidence, between 0 and 1, in each
+	// category.
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+type moderationResponsePayload struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+// CreateModeration classifies the request's inputs, returning one result per
+// input.
+func (c *Client) CreateModeration(ctx context.Context, r *ModerationRequest) ([]ModerationResult, error) {
+	payloadBytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.buildURL("/moderations", r.Model), bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg := fmt.Sprintf("API returned unexpected status code: %d", resp.StatusCode)
+
+		var errResp errorMessage
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return nil, errors.New(msg) // nolint:goerr113
+		}
+		return nil, fmt.Errorf("%s: %s", msg, errResp.Error.Message) // nolint:goerr113
+	}
+
+	var response moderationResponsePayload
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(response.Results) == 0 {
+		return nil, ErrEmptyResponse
+	}
+	return response.Results, nil
+}
@@ -30,6 +30,7 @@ type Client struct {
 	Model        string
 	baseURL      string
 	organization string
+	project      string
 	apiType      APIType
 	httpClient   Doer
 
@@ -43,6 +44,14 @@ type Client struct {
 // Option is an option for the OpenAI client.
 type Option func(*Client) error
 
+// WithProject sets the project sent in the OpenAI-Project header.
+func WithProject(project string) Option {
+	return func(c *Client) error {
+		c.project = project
+		return nil
+	}
+}
+
 // Doer performs a HTTP request.
 type Doer interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -58,7 +67,7 @@ func New(token string, model string, baseURL string, organization string,
 		token:          token,
 		Model:          model,
 		EmbeddingModel: embeddingModel,
-		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		baseURL:        normalizeBaseURL(baseURL),
 		organization:   organization,
 		apiType:        apiType,
 		apiVersion:     apiVersion,
@@ -129,14 +138,18 @@ func (c *Client) CreateEmbedding(ctx context.Context, r *EmbeddingRequest) ([][]
 	return embeddings, nil
 }
 
+// ChatModel returns the model used for chat requests that do not name one.
+func (c *Client) ChatModel() string {
+	if c.Model == "" {
+		return defaultChatModel
+	}
+	return c.Model
+}
+
 // CreateChat creates chat request.
 func (c *Client) CreateChat(ctx context.Context, r *ChatRequest) (*ChatCompletionResponse, error) {
 	if r.Model == "" {
-		if c.Model == "" {
-			r.Model = defaultChatModel
-		} else {
-			r.Model = c.Model
-		}
+		r.Model = c.ChatModel()
 	}
 	resp, err := c.createChat(ctx, r)
 	if err != nil {
@@ -162,19 +175,43 @@ func (c *Client) setHeaders(req *http.Request) {
 	if c.organization != "" {
 		req.Header.Set("OpenAI-Organization", c.organization)
 	}
+	if c.project != "" {
+		req.Header.Set("OpenAI-Project", c.project)
+	}
 }
 
 func (c *Client) buildURL(suffix string, model string) string {
+	return c.buildURLWithBase("", suffix, model)
+}
+
+// buildURLWithBase builds a request URL on baseURL, falling back to the
+// client's base URL when it is empty.
+func (c *Client) buildURLWithBase(baseURL, suffix string, model string) string {
+	if baseURL == "" {
+		baseURL = c.baseURL
+	} else {
+		baseURL = normalizeBaseURL(baseURL)
+	}
 	if IsAzure(c.apiType) {
-		return c.buildAzureURL(suffix, model)
+		return c.buildAzureURL(baseURL, suffix, model)
 	}
 
 	// open ai implement:
-	return fmt.Sprintf("%s%s", c.baseURL, suffix)
+	return fmt.Sprintf("%s%s", baseURL, suffix)
+}
+
+// normalizeBaseURL trims surrounding spaces and trailing slashes from a base
+// URL, so that endpoint paths can be appended to it, and defaults its scheme
+// to https.
+func normalizeBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL != "" && !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	return baseURL
 }
 
-func (c *Client) buildAzureURL(suffix string, model string) string {
-	baseURL := c.baseURL
+func (c *Client) buildAzureURL(baseURL, suffix string, model string) string {
 	baseURL = strings.TrimRight(baseURL, "/")
 
 	// azure example url:
@@ -15,6 +15,7 @@ var (
 	ErrMissingAzureEmbeddingModel = errors.New("embeddings model needs to be provided when using Azure API")
 
 	ErrUnexpectedResponseLength = errors.New("unexpected length of response")
+	ErrInvalidJSONResponse      = errors.New("response is not valid JSON")
 )
 
 // newClient creates an instance of the internal client.
@@ -23,7 +24,8 @@ func newClient(opts ...Option) (*options, *openaiclient.Client, error) {
 		token:        os.Getenv(tokenEnvVarName),
 		model:        os.Getenv(modelEnvVarName),
 		baseURL:      getEnvs(baseURLEnvVarName, baseAPIBaseEnvVarName),
-		organization: os.Getenv(organizationEnvVarName),
+		organization: getEnvs(organizationEnvVarName, orgIDEnvVarName),
+		project:      os.Getenv(projectEnvVarName),
 		apiType:      APIType(openaiclient.APITypeOpenAI),
 		httpClient:   http.DefaultClient,
 	}
@@ -31,6 +33,9 @@ func newClient(opts ...Option) (*options, *openaiclient.Client, error) {
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.chatModel != "" {
+		options.model = options.chatModel
+	}
 
 	// set of options needed for Azure client
 	if openaiclient.IsAzure(openaiclient.APIType(options.apiType)) && options.apiVersion == "" {
@@ -49,7 +54,7 @@ func newClient(opts ...Option) (*options, *openaiclient.Client, error) {
 
 	cli, err := openaiclient.New(options.token, options.model, options.baseURL, options.organization,
 		openaiclient.APIType(options.apiType), options.apiVersion, options.httpClient, options.embeddingModel,
-		options.responseFormat,
+		options.responseFormat, openaiclient.WithProject(options.project),
 	)
 	return options, cli, err
 }
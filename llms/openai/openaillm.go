@@ -2,7 +2,11 @@ package openai
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/averikitsch/langchaingo/callbacks"
 	"github.com/averikitsch/langchaingo/llms"
@@ -11,6 +15,9 @@ import (
 
 type ChatMessage = openaiclient.ChatMessage
 
+// ModerationResult is the classification of one input by Moderate.
+type ModerationResult = openaiclient.ModerationResult
+
 type LLM struct {
 	CallbacksHandler callbacks.Handler
 	client           *openaiclient.Client
@@ -89,8 +96,9 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 		}
 
 		// Here we extract tool calls from the message and populate the ToolCalls field.
+		// ExtractToolParts returns new parts, which are safe to rewrite.
 		newParts, toolCalls := ExtractToolParts(msg)
-		msg.MultiContent = newParts
+		msg.MultiContent = imageDataURLParts(newParts)
 		msg.ToolCalls = toolCallsFromToolCalls(toolCalls)
 
 		chatMsgs = append(chatMsgs, msg)
@@ -112,6 +120,7 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 		FunctionCallBehavior: openaiclient.FunctionCallBehavior(opts.FunctionCallBehavior),
 		Seed:                 opts.Seed,
 		Metadata:             opts.Metadata,
+		BaseURL:              opts.BaseURL,
 	}
 	if opts.JSONMode {
 		req.ResponseFormat = ResponseFormatJSON
@@ -151,16 +160,24 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 		return nil, ErrEmptyResponse
 	}
 
+	jsonMode := req.ResponseFormat != nil && req.ResponseFormat.Type == ResponseFormatJSON.Type
 	choices := make([]*llms.ContentChoice, len(result.Choices))
 	for i, c := range result.Choices {
+		// JSON mode only constrains plain message content; tool calls carry
+		// their own arguments.
+		if jsonMode && len(c.Message.ToolCalls) == 0 && !json.Valid([]byte(c.Message.Content)) {
+			return nil, fmt.Errorf("%w: choice %d", ErrInvalidJSONResponse, i)
+		}
 		choices[i] = &llms.ContentChoice{
 			Content:    c.Message.Content,
 			StopReason: fmt.Sprint(c.FinishReason),
 			GenerationInfo: map[string]any{
-				"CompletionTokens": result.Usage.CompletionTokens,
-				"PromptTokens":     result.Usage.PromptTokens,
-				"TotalTokens":      result.Usage.TotalTokens,
-				"ReasoningTokens":  result.Usage.CompletionTokensDetails.ReasoningTokens,
+				"CompletionTokens":  result.Usage.CompletionTokens,
+				"PromptTokens":      result.Usage.PromptTokens,
+				"TotalTokens":       result.Usage.TotalTokens,
+				"ReasoningTokens":   result.Usage.CompletionTokensDetails.ReasoningTokens,
+				"FinishReason":      string(c.FinishReason),
+				"SystemFingerprint": result.SystemFingerprint,
 			},
 		}
 
@@ -193,12 +210,24 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 	return response, nil
 }
 
-// CreateEmbedding creates embeddings for the given input texts.
+// GetNumTokens returns the number of tokens text is encoded to by the
+// tokenizer of the LLM's chat model. Models without a known tokenizer fall
+// back to the approximation of llms.CountTokens.
+func (o *LLM) GetNumTokens(text string) int {
+	return llms.CountTokens(o.client.ChatModel(), text)
+}
+
+// CreateEmbedding creates embeddings for the given input texts. It implements
+// embeddings.EmbedderClient, so an LLM can be passed to embeddings.NewEmbedder
+// to embed documents for a vector store.
 func (o *LLM) CreateEmbedding(ctx context.Context, inputTexts []string) ([][]float32, error) {
 	embeddings, err := o.client.CreateEmbedding(ctx, &openaiclient.EmbeddingRequest{
 		Input: inputTexts,
 		Model: o.client.EmbeddingModel,
 	})
+	if errors.Is(err, openaiclient.ErrEmptyResponse) {
+		return nil, ErrEmptyResponse
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create openai embeddings: %w", err)
 	}
@@ -211,6 +240,53 @@ func (o *LLM) CreateEmbedding(ctx context.Context, inputTexts []string) ([][]flo
 	return embeddings, nil
 }
 
+// EmbedQuery embeds a single text. A context that is already done is reported
+// before any request is sent.
+func (o *LLM) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	embeddings, err := o.CreateEmbedding(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// Moderate classifies the inputs with the OpenAI moderations API, returning
+// for each input whether it was flagged and its per-category flags and
+// scores.
+func (o *LLM) Moderate(ctx context.Context, inputs []string) ([]ModerationResult, error) {
+	results, err := o.client.CreateModeration(ctx, &openaiclient.ModerationRequest{Input: inputs})
+	if errors.Is(err, openaiclient.ErrEmptyResponse) {
+		return nil, ErrEmptyResponse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create openai moderation: %w", err)
+	}
+	if len(results) != len(inputs) {
+		return results, ErrUnexpectedResponseLength
+	}
+	return results, nil
+}
+
+// imageDataURLParts replaces binary image parts with image URL parts holding
+// base64 data URLs, the form in which the chat API accepts inline images.
+// Other parts are left unchanged. The parts are replaced in place, so they
+// must not alias the caller's message.
+func imageDataURLParts(parts []llms.ContentPart) []llms.ContentPart {
+	for i, part := range parts {
+		bc, ok := part.(llms.BinaryContent)
+		if !ok || !strings.HasPrefix(bc.MIMEType, "image/") {
+			continue
+		}
+		parts[i] = llms.ImageURLContent{
+			URL: fmt.Sprintf("data:%s;base64,%s", bc.MIMEType, base64.StdEncoding.EncodeToString(bc.Data)),
+		}
+	}
+	return parts
+}
+
 // ExtractToolParts extracts the tool parts from a message.
 func ExtractToolParts(msg *ChatMessage) ([]llms.ContentPart, []llms.ToolCall) {
 	var content []llms.ContentPart
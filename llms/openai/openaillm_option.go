@@ -11,6 +11,8 @@ const (
 	baseURLEnvVarName      = "OPENAI_BASE_URL"     //nolint:gosec
 	baseAPIBaseEnvVarName  = "OPENAI_API_BASE"     //nolint:gosec
 	organizationEnvVarName = "OPENAI_ORGANIZATION" //nolint:gosec
+	orgIDEnvVarName        = "OPENAI_ORG_ID"       //nolint:gosec
+	projectEnvVarName      = "OPENAI_PROJECT"      //nolint:gosec
 )
 
 type APIType openaiclient.APIType
@@ -28,8 +30,10 @@ const (
 type options struct {
 	token        string
 	model        string
+	chatModel    string
 	baseURL      string
 	organization string
+	project      string
 	apiType      APIType
 	httpClient   openaiclient.Doer
 
@@ -66,7 +70,8 @@ func WithToken(token string) Option {
 }
 
 // WithModel passes the OpenAI model to the client. If not set, the model
-// is read from the OPENAI_MODEL environment variable.
+// is read from the OPENAI_MODEL environment variable. It is the default model
+// of chat requests unless WithChatModel is set.
 // Required when ApiType is Azure.
 func WithModel(model string) Option {
 	return func(opts *options) {
@@ -74,7 +79,17 @@ func WithModel(model string) Option {
 	}
 }
 
-// WithEmbeddingModel passes the OpenAI model to the client. Required when ApiType is Azure.
+// WithChatModel sets the default model of chat requests, overriding WithModel
+// for them. Calls can still name another model with llms.WithModel.
+func WithChatModel(chatModel string) Option {
+	return func(opts *options) {
+		opts.chatModel = chatModel
+	}
+}
+
+// WithEmbeddingModel sets the model of embedding requests, which is separate
+// from the chat model. If not set, text-embedding-ada-002 is used.
+// Required when ApiType is Azure.
 func WithEmbeddingModel(embeddingModel string) Option {
 	return func(opts *options) {
 		opts.embeddingModel = embeddingModel
@@ -91,13 +106,21 @@ func WithBaseURL(baseURL string) Option {
 }
 
 // WithOrganization passes the OpenAI organization to the client. If not set, the
-// organization is read from the OPENAI_ORGANIZATION.
+// organization is read from the OPENAI_ORGANIZATION or OPENAI_ORG_ID environment variable.
 func WithOrganization(organization string) Option {
 	return func(opts *options) {
 		opts.organization = organization
 	}
 }
 
+// WithProject passes the OpenAI project to the client. If not set, the
+// project is read from the OPENAI_PROJECT environment variable.
+func WithProject(project string) Option {
+	return func(opts *options) {
+		opts.project = project
+	}
+}
+
 // WithAPIType passes the api type to the client. If not set, the default value
 // is APITypeOpenAI.
 func WithAPIType(apiType APIType) Option {
@@ -114,11 +137,15 @@ func WithAPIVersion(apiVersion string) Option {
 	}
 }
 
-// WithHTTPClient allows setting a custom HTTP client. If not set, the default value
-// is http.DefaultClient.
+// WithHTTPClient allows setting a custom HTTP client, such as an *http.Client
+// with a proxy, TLS configuration or timeouts. It is used for all chat and
+// embedding requests. If not set, or set to nil, the default value is
+// http.DefaultClient.
 func WithHTTPClient(client openaiclient.Doer) Option {
 	return func(opts *options) {
-		opts.httpClient = client
+		if client != nil {
+			opts.httpClient = client
+		}
 	}
 }
 
@@ -0,0 +1,594 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/averikitsch/langchaingo/embeddings"
+	"github.com/averikitsch/langchaingo/llms"
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDoer answers every request with a canned response body and records
+// the headers and body of the last request it received.
+type fakeDoer struct {
+	response      string
+	requestHeader http.Header
+	requestBody   []byte
+}
+
+func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	d.requestHeader = req.Header
+	d.requestBody = body
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(d.response)),
+	}, nil
+}
+
+func newFakeLLM(t *testing.T, doer *fakeDoer, opts ...Option) *LLM {
+	t.Helper()
+	opts = append([]Option{WithToken("fake-token"), WithHTTPClient(doer)}, opts...)
+	llm, err := New(opts...)
+	require.NoError(t, err)
+	return llm
+}
+
+func TestGenerateContentReportsUsage(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 7, "completion_tokens": 3, "total_tokens": 10}
+	}`}
+	llm := newFakeLLM(t, doer)
+
+	rsp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+	})
+	require.NoError(t, err)
+	require.Len(t, rsp.Choices, 1)
+
+	info := rsp.Choices[0].GenerationInfo
+	assert.Equal(t, 7, info["PromptTokens"])
+	assert.Equal(t, 3, info["CompletionTokens"])
+	assert.Equal(t, 10, info["TotalTokens"])
+	assert.Equal(t, "stop", info["FinishReason"])
+
+	var req map[string]any
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	assert.NotEmpty(t, req["messages"])
+}
+
+func TestGenerateContentJSONMode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid json", content: `{\"answer\": 42}`},
+		{name: "invalid json", content: `the answer is 42`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			doer := &fakeDoer{response: `{
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "` + tt.content + `"}, "finish_reason": "stop"}]
+			}`}
+			llm := newFakeLLM(t, doer)
+
+			rsp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "answer in json"),
+			}, llms.WithJSONMode())
+
+			var req struct {
+				ResponseFormat *ResponseFormat `json:"response_format"`
+			}
+			require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+			require.NotNil(t, req.ResponseFormat)
+			assert.Equal(t, "json_object", req.ResponseFormat.Type)
+
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidJSONResponse)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"answer": 42}`, rsp.Choices[0].Content)
+		})
+	}
+}
+
+func TestOrganizationAndProjectHeaders(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}}]}`}
+	llm := newFakeLLM(t, doer, WithOrganization("org-123"), WithProject("proj-456"))
+
+	_, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "org-123", doer.requestHeader.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj-456", doer.requestHeader.Get("OpenAI-Project"))
+}
+
+//nolint:paralleltest // t.Setenv cannot be used in parallel tests.
+func TestOrganizationAndProjectFromEnv(t *testing.T) {
+	t.Setenv(organizationEnvVarName, "")
+	os.Unsetenv(organizationEnvVarName)
+	t.Setenv(orgIDEnvVarName, "org-env")
+	t.Setenv(projectEnvVarName, "proj-env")
+
+	doer := &fakeDoer{response: `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}}]}`}
+	llm := newFakeLLM(t, doer)
+
+	_, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "org-env", doer.requestHeader.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj-env", doer.requestHeader.Get("OpenAI-Project"))
+}
+
+func TestEmbedQuery(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{"data": [{"embedding": [0.1, 0.2, 0.3], "index": 0}]}`}
+	llm := newFakeLLM(t, doer)
+
+	embedding, err := llm.EmbedQuery(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.1, 0.2, 0.3}, embedding)
+
+	var req struct {
+		Input []string `json:"input"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	assert.Equal(t, []string{"hello"}, req.Input)
+}
+
+func TestEmbedQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	doer := &fakeDoer{response: `{"data": []}`}
+	_, err := newFakeLLM(t, doer).EmbedQuery(context.Background(), "hello")
+	require.ErrorIs(t, err, ErrEmptyResponse)
+
+	doer = &fakeDoer{response: `{"data": [{"embedding": [0.1], "index": 0}]}`}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = newFakeLLM(t, doer).EmbedQuery(ctx, "hello")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, doer.requestBody)
+}
+
+// recordingTransport is an http.RoundTripper that answers with a canned
+// response body and records the paths and URLs it was asked for.
+type recordingTransport struct {
+	response string
+	paths    []string
+	urls     []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.paths = append(rt.paths, req.URL.Path)
+	rt.urls = append(rt.urls, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(rt.response)),
+		Request:    req,
+	}, nil
+}
+
+func TestHTTPClientTransport(t *testing.T) {
+	t.Parallel()
+	transport := &recordingTransport{}
+	llm, err := New(WithToken("fake-token"), WithHTTPClient(&http.Client{Transport: transport}))
+	require.NoError(t, err)
+
+	transport.response = `{"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`
+	_, err = llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+	})
+	require.NoError(t, err)
+
+	transport.response = `{"data": [{"embedding": [0.1], "index": 0}]}`
+	_, err = llm.CreateEmbedding(context.Background(), []string{"hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/v1/chat/completions", "/v1/embeddings"}, transport.paths)
+}
+
+// recordBaseURLCalls makes a chat call through Call and GenerateContent and
+// an embeddings call with llm, returning the URLs they were sent to.
+func recordBaseURLCalls(t *testing.T, llm *LLM, transport *recordingTransport) []string {
+	t.Helper()
+	ctx := context.Background()
+	transport.response = `{"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`
+	_, err := llm.Call(ctx, "hello")
+	require.NoError(t, err)
+	_, err = llm.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hello")})
+	require.NoError(t, err)
+	transport.response = `{"data": [{"embedding": [0.1], "index": 0}]}`
+	_, err = llm.CreateEmbedding(ctx, []string{"hello"})
+	require.NoError(t, err)
+	return transport.urls
+}
+
+func TestBaseURLNormalization(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"https://api.example.com/v1", "https://api.example.com/v1"},
+		{"https://api.example.com/v1/", "https://api.example.com/v1"},
+		{"https://api.example.com/v1//", "https://api.example.com/v1"},
+		{" https://api.example.com/v1 ", "https://api.example.com/v1"},
+		{"api.example.com/v1", "https://api.example.com/v1"},
+		{"http://localhost:8080/", "http://localhost:8080"},
+		{"", "https://api.openai.com/v1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.baseURL, func(t *testing.T) {
+			t.Parallel()
+			transport := &recordingTransport{}
+			llm, err := New(
+				WithToken("fake-token"),
+				WithBaseURL(tc.baseURL),
+				WithHTTPClient(&http.Client{Transport: transport}),
+			)
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{
+				tc.expected + "/chat/completions",
+				tc.expected + "/chat/completions",
+				tc.expected + "/embeddings",
+			}, recordBaseURLCalls(t, llm, transport))
+		})
+	}
+}
+
+func TestBaseURLFromEnv(t *testing.T) {
+	t.Setenv(baseURLEnvVarName, "gateway.example.com/openai/")
+	transport := &recordingTransport{}
+	llm, err := New(WithToken("fake-token"), WithHTTPClient(&http.Client{Transport: transport}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"https://gateway.example.com/openai/chat/completions",
+		"https://gateway.example.com/openai/chat/completions",
+		"https://gateway.example.com/openai/embeddings",
+	}, recordBaseURLCalls(t, llm, transport))
+}
+
+func TestGenerateContentBaseURLOverride(t *testing.T) {
+	t.Parallel()
+	transport := &recordingTransport{
+		response: `{"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`,
+	}
+	llm, err := New(
+		WithToken("fake-token"),
+		WithBaseURL("https://default.example.com/v1"),
+		WithHTTPClient(&http.Client{Transport: transport}),
+	)
+	require.NoError(t, err)
+
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hello")}
+	_, err = llm.GenerateContent(context.Background(), messages, llms.WithBaseURL("https://gateway-a.example.com/v1/"))
+	require.NoError(t, err)
+	_, err = llm.GenerateContent(context.Background(), messages, llms.WithBaseURL("https://gateway-b.example.com/openai"))
+	require.NoError(t, err)
+	_, err = llm.GenerateContent(context.Background(), messages)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"https://gateway-a.example.com/v1/chat/completions",
+		"https://gateway-b.example.com/openai/chat/completions",
+		"https://default.example.com/v1/chat/completions",
+	}, transport.urls)
+}
+
+func TestHTTPClientNilUsesDefault(t *testing.T) {
+	t.Parallel()
+	opts := &options{httpClient: http.DefaultClient}
+	WithHTTPClient(nil)(opts)
+	assert.Equal(t, http.DefaultClient, opts.httpClient)
+}
+
+func TestGetNumTokens(t *testing.T) {
+	t.Parallel()
+	if _, err := tiktoken.EncodingForModel("gpt-4"); err != nil {
+		t.Skipf("tiktoken encoding not available: %v", err)
+	}
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{model: "gpt-4", text: "hello world", want: 2},
+		{model: "gpt-4", text: "tiktoken is great!", want: 6},
+		{model: "gpt-3.5-turbo", text: "tiktoken is great!", want: 6},
+		{model: "", text: "tiktoken is great!", want: 6},
+		{model: "gpt-4", text: "", want: 0},
+	}
+	for _, tc := range tests {
+		llm := newFakeLLM(t, &fakeDoer{}, WithModel(tc.model))
+		assert.Equal(t, tc.want, llm.GetNumTokens(tc.text), "model %q, text %q", tc.model, tc.text)
+	}
+}
+
+func TestGenerateContentToolCalls(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{"choices": [{"message": {"role": "assistant", "content": null,
+		"tool_calls": [{"id": "call_1", "type": "function",
+		"function": {"name": "getWeather", "arguments": "{\"city\":\"Tokyo\"}"}}]},
+		"finish_reason": "tool_calls"}]}`}
+	llm := newFakeLLM(t, doer)
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "What is the weather in Tokyo?"),
+	}, llms.WithTools([]llms.Tool{{
+		Type: "function",
+		Function: &llms.FunctionDefinition{
+			Name:       "getWeather",
+			Parameters: map[string]any{"type": "object"},
+		},
+	}}))
+	require.NoError(t, err)
+
+	var req struct {
+		Tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	require.Len(t, req.Tools, 1)
+	assert.Equal(t, "function", req.Tools[0].Type)
+	assert.Equal(t, "getWeather", req.Tools[0].Function.Name)
+
+	require.Len(t, resp.Choices, 1)
+	choice := resp.Choices[0]
+	assert.Empty(t, choice.Content)
+	assert.Equal(t, "tool_calls", choice.StopReason)
+	require.Len(t, choice.ToolCalls, 1)
+	assert.Equal(t, "call_1", choice.ToolCalls[0].ID)
+	assert.Equal(t, "getWeather", choice.ToolCalls[0].FunctionCall.Name)
+	assert.JSONEq(t, `{"city":"Tokyo"}`, choice.ToolCalls[0].FunctionCall.Arguments)
+	assert.Equal(t, choice.ToolCalls[0].FunctionCall, choice.FuncCall)
+}
+
+func TestGenerateContentSeedAndFingerprint(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{"system_fingerprint": "fp_44709d6fcb",
+		"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`}
+	llm := newFakeLLM(t, doer)
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+	}, llms.WithSeed(42))
+	require.NoError(t, err)
+
+	var req struct {
+		Seed int `json:"seed"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	assert.Equal(t, 42, req.Seed)
+	assert.Equal(t, "fp_44709d6fcb", resp.Choices[0].GenerationInfo["SystemFingerprint"])
+}
+
+// The embeddings package tests import this package, so the interface check
+// lives here rather than next to CreateEmbedding.
+var _ embeddings.EmbedderClient = (*LLM)(nil)
+
+func TestNewEmbedder(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{
+		"object": "list",
+		"data": [
+			{"object": "embedding", "index": 0, "embedding": [0.1, 0.2]},
+			{"object": "embedding", "index": 1, "embedding": [0.3, 0.4]}
+		],
+		"model": "text-embedding-ada-002",
+		"usage": {"prompt_tokens": 4, "total_tokens": 4}
+	}`}
+	llm := newFakeLLM(t, doer, WithEmbeddingModel("text-embedding-3-small"))
+
+	embedder, err := embeddings.NewEmbedder(llm)
+	require.NoError(t, err)
+	vectors, err := embedder.EmbedDocuments(context.Background(), []string{"Tokyo", "Kyoto"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{0.1, 0.2}, {0.3, 0.4}}, vectors)
+
+	var req struct {
+		Input []string `json:"input"`
+		Model string   `json:"model"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	assert.Equal(t, []string{"Tokyo", "Kyoto"}, req.Input)
+	assert.Equal(t, "text-embedding-3-small", req.Model)
+}
+
+func TestDefaultModelsPerRequestType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		opts           []Option
+		callOpts       []llms.CallOption
+		chatModel      string
+		embeddingModel string
+	}{
+		{
+			name:           "generic model",
+			opts:           []Option{WithModel("gpt-4")},
+			chatModel:      "gpt-4",
+			embeddingModel: "text-embedding-ada-002",
+		},
+		{
+			name:           "separate defaults",
+			opts:           []Option{WithModel("gpt-4"), WithChatModel("gpt-4o"), WithEmbeddingModel("text-embedding-3-small")},
+			chatModel:      "gpt-4o",
+			embeddingModel: "text-embedding-3-small",
+		},
+		{
+			name:           "per-call model",
+			opts:           []Option{WithChatModel("gpt-4o"), WithEmbeddingModel("text-embedding-3-small")},
+			callOpts:       []llms.CallOption{llms.WithModel("gpt-4o-mini")},
+			chatModel:      "gpt-4o-mini",
+			embeddingModel: "text-embedding-3-small",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			doer := &fakeDoer{}
+			llm := newFakeLLM(t, doer, tc.opts...)
+			var req struct {
+				Model string `json:"model"`
+			}
+
+			doer.response = `{"choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`
+			_, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+			}, tc.callOpts...)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+			assert.Equal(t, tc.chatModel, req.Model)
+
+			doer.response = `{"data": [{"embedding": [0.1], "index": 0}]}`
+			_, err = llm.CreateEmbedding(context.Background(), []string{"hello"})
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+			assert.Equal(t, tc.embeddingModel, req.Model)
+		})
+	}
+}
+
+func TestGenerateContentImageParts(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "a parrot"}, "finish_reason": "stop"}]
+	}`}
+	llm := newFakeLLM(t, doer)
+	image := llms.BinaryPart("image/png", []byte("png"))
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You describe images."),
+		{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{
+				llms.TextPart("describe these images"),
+				llms.ImageURLWithDetailPart("https://example.com/parrot.png", "low"),
+				image,
+			},
+		},
+	}
+
+	_, err := llm.GenerateContent(context.Background(), messages)
+	require.NoError(t, err)
+
+	var req struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	require.Len(t, req.Messages, 2)
+	assert.JSONEq(t, `{"role": "system", "content": "You describe images."}`, string(req.Messages[0]))
+	assert.JSONEq(t, `{"role": "user", "content": [
+		{"type": "text", "text": "describe these images"},
+		{"type": "image_url", "image_url": {"url": "https://example.com/parrot.png", "detail": "low"}},
+		{"type": "image_url", "image_url": {"url": "data:image/png;base64,cG5n"}}
+	]}`, string(req.Messages[1]))
+	// The caller's message keeps its binary part.
+	assert.Equal(t, image, messages[1].Parts[2])
+}
+
+func TestModerate(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{
+		"id": "modr-1",
+		"model": "omni-moderation-latest",
+		"results": [
+			{
+				"flagged": true,
+				"categories": {"hate": false, "violence": true},
+				"category_scores": {"hate": 0.01, "violence": 0.93}
+			},
+			{
+				"flagged": false,
+				"categories": {"hate": false, "violence": false},
+				"category_scores": {"hate": 0.001, "violence": 0.002}
+			}
+		]
+	}`}
+	llm := newFakeLLM(t, doer)
+
+	results, err := llm.Moderate(context.Background(), []string{"I will hurt you", "hello"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.True(t, results[0].Flagged)
+	require.Equal(t, map[string]bool{"hate": false, "violence": true}, results[0].Categories)
+	require.InDelta(t, 0.93, results[0].CategoryScores["violence"], 1e-9)
+	require.False(t, results[1].Flagged)
+	require.JSONEq(t, `{"input": ["I will hurt you", "hello"]}`, string(doer.requestBody))
+
+	doer.response = `{"results": []}`
+	_, err = llm.Moderate(context.Background(), []string{"hello"})
+	require.ErrorIs(t, err, ErrEmptyResponse)
+}
+
+func TestGenerateContentMessageRoles(t *testing.T) {
+	t.Parallel()
+	doer := &fakeDoer{response: `{"choices": [{"message": {"role": "assistant", "content": "Sunny."},
+		"finish_reason": "stop"}]}`}
+	llm := newFakeLLM(t, doer)
+	toolCall := llms.ToolCall{
+		ID:           "call_1",
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: "getWeather", Arguments: `{"city":"Tokyo"}`},
+	}
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are a weather bot."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "What is the weather", "in Tokyo?"),
+		{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{toolCall}},
+		{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{
+			llms.ToolCallResponse{ToolCallID: "call_1", Name: "getWeather", Content: "sunny"},
+		}},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Sunny.", resp.Choices[0].Content)
+
+	var req struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(doer.requestBody, &req))
+	require.Len(t, req.Messages, 4)
+	assert.JSONEq(t, `{"role": "system", "content": "You are a weather bot."}`, string(req.Messages[0]))
+	assert.JSONEq(t, `{"role": "user", "content": [
+		{"type": "text", "text": "What is the weather"},
+		{"type": "text", "text": "in Tokyo?"}
+	]}`, string(req.Messages[1]))
+	assert.JSONEq(t, `{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function",
+		"function": {"name": "getWeather", "arguments": "{\"city\":\"Tokyo\"}"}}]}`, string(req.Messages[2]))
+	assert.JSONEq(t, `{"role": "tool", "content": "sunny", "tool_call_id": "call_1"}`, string(req.Messages[3]))
+
+	// A tool message holds exactly one tool call response.
+	_, err = llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeTool, "sunny"),
+	})
+	require.ErrorContains(t, err, "expected part of type ToolCallResponse")
+}
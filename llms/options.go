@@ -69,6 +69,11 @@ type CallOptions struct {
 	// Supported MIME types are: text/plain: (default) Text output.
 	// application/json: JSON response in the response candidates.
 	ResponseMIMEType string `json:"response_mime_type,omitempty"`
+
+	// BaseURL overrides the base URL of the client for this call, so that a
+	// single model can route requests through different gateways.
+	// Currently only supported by openai llms.
+	BaseURL string `json:"base_url,omitempty"`
 }
 
 // Tool is a tool that can be used by the model.
@@ -290,3 +295,12 @@ func WithResponseMIMEType(responseMIMEType string) CallOption {
 		o.ResponseMIMEType = responseMIMEType
 	}
 }
+
+// WithBaseURL will add an option to send the call to the given base URL
+// instead of the client's, such as "https://gateway.example.com/v1".
+// Currently only supported by openai llms.
+func WithBaseURL(baseURL string) CallOption {
+	return func(o *CallOptions) {
+		o.BaseURL = baseURL
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/averikitsch/langchaingo/internal/sqlutil"
 	"github.com/averikitsch/langchaingo/llms"
 	"github.com/averikitsch/langchaingo/schema"
 	"github.com/averikitsch/langchaingo/util/cloudsqlutil"
@@ -17,8 +19,30 @@ type ChatMessageHistory struct {
 	sessionID  string
 	tableName  string
 	schemaName string
+	// userID, when set, keys messages by user_id as well as session_id.
+	userID string
+	// qualifiedTableName is the quoted "schema"."table" identifier used in
+	// every query.
+	qualifiedTableName string
+	// hasMetadataColumn reports whether the table has the optional metadata
+	// column.
+	hasMetadataColumn bool
 }
 
+// MessageWithMetadata is a chat message together with its stored metadata.
+type MessageWithMetadata struct {
+	Message  llms.ChatMessage
+	Metadata map[string]any
+}
+
+// ErrMissingMetadataColumn is returned when metadata is stored in a table
+// created without the metadata column.
+var ErrMissingMetadataColumn = errors.New("chat history table has no metadata column")
+
+// ErrMissingUserIDColumn is returned when a user id is set for a table
+// created without the user_id column.
+var ErrMissingUserIDColumn = errors.New("chat history table has no user_id column")
+
 var _ schema.ChatMessageHistory = &ChatMessageHistory{}
 
 // NewChatMessageHistory creates a new NewChatMessageHistory with options.
@@ -46,6 +70,11 @@ func NewChatMessageHistory(ctx context.Context,
 	}
 	cmh = applyChatMessageHistoryOptions(cmh, opts...)
 
+	cmh.qualifiedTableName, err = sqlutil.QuoteQualifiedIdentifier(cmh.schemaName, cmh.tableName)
+	if err != nil {
+		return ChatMessageHistory{}, fmt.Errorf("invalid table '%s' in schema '%s': %w", tableName, cmh.schemaName, err)
+	}
+
 	err = cmh.validateTable(ctx)
 	if err != nil {
 		return ChatMessageHistory{}, fmt.Errorf("error validating table '%s' in schema '%s': %w", tableName, cmh.schemaName, err)
@@ -110,31 +139,94 @@ func (c *ChatMessageHistory) validateTable(ctx context.Context) error {
 				reqColumn, c.tableName, actualType, expectedType)
 		}
 	}
+	c.hasMetadataColumn = columns["metadata"] == "jsonb"
+	if c.userID != "" && columns["user_id"] != "text" {
+		return ErrMissingUserIDColumn
+	}
 	return nil
 }
 
 // addMessage adds a new message into the ChatMessageHistory for a given
 // session.
 func (c *ChatMessageHistory) addMessage(ctx context.Context, content string, messageType llms.ChatMessageType) error {
+	return c.addMessageWithMetadata(ctx, content, messageType, nil)
+}
+
+// addMessageWithMetadata adds a new message and its metadata into the
+// ChatMessageHistory for a given session.
+func (c *ChatMessageHistory) addMessageWithMetadata(ctx context.Context, content string,
+	messageType llms.ChatMessageType, metadata map[string]any,
+) error {
 	// Marshal to convert content into a valid JSON format before inserting it into the database.
 	data, err := json.Marshal(content)
 	if err != nil {
 		return fmt.Errorf("failed to serialize content to JSON: %w", err)
 	}
-	query := fmt.Sprintf(`INSERT INTO %q.%q (session_id, data, type) VALUES ($1, $2, $3)`, c.schemaName, c.tableName)
-
-	_, err = c.engine.Pool.Exec(ctx, query, c.sessionID, data, messageType)
+	var metadataJSON []byte
+	if len(metadata) > 0 {
+		if !c.hasMetadataColumn {
+			return ErrMissingMetadataColumn
+		}
+		metadataJSON, err = json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metadata to JSON: %w", err)
+		}
+	}
+	query, args := c.insertStatement(data, messageType, metadataJSON)
+	_, err = c.engine.Pool.Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to add message to database: %w", err)
 	}
 	return nil
 }
 
+// insertStatement returns the statement inserting a message of the session,
+// with its metadata when not nil, and its arguments.
+func (c *ChatMessageHistory) insertStatement(data []byte, messageType llms.ChatMessageType,
+	metadata []byte,
+) (string, []any) {
+	columns := []string{"session_id", "data", "type"}
+	args := []any{c.sessionID, data, messageType}
+	if metadata != nil {
+		columns = append(columns, "metadata")
+		args = append(args, metadata)
+	}
+	if c.userID != "" {
+		columns = append(columns, "user_id")
+		args = append(args, c.userID)
+	}
+	placeholders := make([]string, len(args))
+	for i := range args {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+		c.qualifiedTableName, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	return query, args
+}
+
+// sessionCondition returns the WHERE condition matching the messages of the
+// session, and of the user when one is set, and its arguments.
+func (c *ChatMessageHistory) sessionCondition() (string, []any) {
+	if c.userID == "" {
+		return "session_id = $1", []any{c.sessionID}
+	}
+	return "session_id = $1 AND user_id = $2", []any{c.sessionID, c.userID}
+}
+
 // AddMessage adds a message to the ChatMessageHistory.
 func (c *ChatMessageHistory) AddMessage(ctx context.Context, message llms.ChatMessage) error {
 	return c.addMessage(ctx, message.GetContent(), message.GetType())
 }
 
+// AddMessageWithMetadata adds a message and its metadata to the
+// ChatMessageHistory. The table must have been created with the metadata
+// column, otherwise ErrMissingMetadataColumn is returned.
+func (c *ChatMessageHistory) AddMessageWithMetadata(ctx context.Context, message llms.ChatMessage,
+	metadata map[string]any,
+) error {
+	return c.addMessageWithMetadata(ctx, message.GetContent(), message.GetType(), metadata)
+}
+
 // AddAIMessage adds an AI-generated message to the ChatMessageHistory.
 func (c *ChatMessageHistory) AddAIMessage(ctx context.Context, content string) error {
 	return c.addMessage(ctx, content, llms.ChatMessageTypeAI)
@@ -148,20 +240,40 @@ func (c *ChatMessageHistory) AddUserMessage(ctx context.Context, content string)
 // Clear removes all messages associated with a session from the
 // ChatMessageHistory.
 func (c *ChatMessageHistory) Clear(ctx context.Context) error {
-	query := fmt.Sprintf(`DELETE FROM %q.%q WHERE session_id = $1`, c.schemaName, c.tableName)
+	condition, args := c.sessionCondition()
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, c.qualifiedTableName, condition)
 
-	_, err := c.engine.Pool.Exec(ctx, query, c.sessionID)
+	_, err := c.engine.Pool.Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to clear session %s: %w", c.sessionID, err)
 	}
 	return err
 }
 
+// Count returns the number of messages stored for the session.
+func (c *ChatMessageHistory) Count(ctx context.Context) (int, error) {
+	condition, args := c.sessionCondition()
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, c.qualifiedTableName, condition)
+
+	var count int
+	if err := c.engine.Pool.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count messages for session %s: %w", c.sessionID, err)
+	}
+	return count, nil
+}
+
 // AddMessages adds multiple messages to the ChatMessageHistory for a given
-// session.
+// session. The messages are added in a single transaction, so either all of
+// them are stored or none are.
 func (c *ChatMessageHistory) AddMessages(ctx context.Context, messages []llms.ChatMessage) error {
+	return pgx.BeginFunc(ctx, c.engine.Pool, func(tx pgx.Tx) error {
+		return c.insertMessages(ctx, tx, messages)
+	})
+}
+
+// insertMessages adds messages to the session within tx.
+func (c *ChatMessageHistory) insertMessages(ctx context.Context, tx pgx.Tx, messages []llms.ChatMessage) error {
 	b := &pgx.Batch{}
-	query := fmt.Sprintf(`INSERT INTO %q.%q (session_id, data, type) VALUES ($1, $2, $3)`, c.schemaName, c.tableName)
 
 	for _, message := range messages {
 		// Marshal to convert content into a valid JSON format before inserting it into the database.
@@ -169,31 +281,96 @@ func (c *ChatMessageHistory) AddMessages(ctx context.Context, messages []llms.Ch
 		if err != nil {
 			return fmt.Errorf("failed to serialize content to JSON: %w", err)
 		}
-		b.Queue(query, c.sessionID, data, message.GetType())
+		query, args := c.insertStatement(data, message.GetType(), nil)
+		b.Queue(query, args...)
 	}
-	return c.engine.Pool.SendBatch(ctx, b).Close()
+	return tx.SendBatch(ctx, b).Close()
 }
 
 // Messages retrieves all messages associated with a session from the
 // ChatMessageHistory.
 func (c *ChatMessageHistory) Messages(ctx context.Context) ([]llms.ChatMessage, error) {
+	stored, err := c.MessagesWithMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var messages []llms.ChatMessage
+	for _, m := range stored {
+		messages = append(messages, m.Message)
+	}
+	return messages, nil
+}
+
+// MessagesByType retrieves the messages of the given type associated with a
+// session from the ChatMessageHistory.
+func (c *ChatMessageHistory) MessagesByType(ctx context.Context, t llms.ChatMessageType) ([]llms.ChatMessage, error) {
+	condition, args := c.sessionCondition()
+	condition += fmt.Sprintf(" AND type = $%d", len(args)+1)
+	stored, err := c.queryMessages(ctx, condition, append(args, string(t))...)
+	if err != nil {
+		return nil, err
+	}
+	var messages []llms.ChatMessage
+	for _, m := range stored {
+		messages = append(messages, m.Message)
+	}
+	return messages, nil
+}
+
+// LastMessages retrieves the last n messages associated with a session in
+// insertion order, without reading the older messages. A non-positive n
+// retrieves all messages.
+func (c *ChatMessageHistory) LastMessages(ctx context.Context, n int) ([]llms.ChatMessage, error) {
+	if n <= 0 {
+		return c.Messages(ctx)
+	}
+	sessionCondition, args := c.sessionCondition()
+	condition := fmt.Sprintf("id IN (SELECT id FROM %s WHERE %s ORDER BY id DESC LIMIT $%d)",
+		c.qualifiedTableName, sessionCondition, len(args)+1)
+	stored, err := c.queryMessages(ctx, condition, append(args, n)...)
+	if err != nil {
+		return nil, err
+	}
+	var messages []llms.ChatMessage
+	for _, m := range stored {
+		messages = append(messages, m.Message)
+	}
+	return messages, nil
+}
+
+// MessagesWithMetadata retrieves all messages associated with a session
+// together with their metadata. Messages stored without metadata, or in a
+// table without the metadata column, have nil Metadata.
+func (c *ChatMessageHistory) MessagesWithMetadata(ctx context.Context) ([]MessageWithMetadata, error) {
+	condition, args := c.sessionCondition()
+	return c.queryMessages(ctx, condition, args...)
+}
+
+// queryMessages retrieves the messages matching the given WHERE condition in
+// insertion order.
+func (c *ChatMessageHistory) queryMessages(ctx context.Context, condition string, args ...any) ([]MessageWithMetadata, error) {
+	metadataColumn := "NULL::jsonb"
+	if c.hasMetadataColumn {
+		metadataColumn = "metadata"
+	}
 	query := fmt.Sprintf(
-		`SELECT id, session_id, data, type FROM %q.%q WHERE session_id = $1 ORDER BY id`,
-		c.schemaName, c.tableName,
+		`SELECT id, session_id, data, type, %s FROM %s WHERE %s ORDER BY id`,
+		metadataColumn, c.qualifiedTableName, condition,
 	)
 
-	rows, err := c.engine.Pool.Query(ctx, query, c.sessionID)
+	rows, err := c.engine.Pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []llms.ChatMessage
+	var messages []MessageWithMetadata
 	for rows.Next() {
 		var id int
 		var sessionID, data, messageType string
+		var metadata []byte
 
-		if err := rows.Scan(&id, &sessionID, &data, &messageType); err != nil {
+		if err := rows.Scan(&id, &sessionID, &data, &messageType, &metadata); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -205,16 +382,23 @@ func (c *ChatMessageHistory) Messages(ctx context.Context) ([]llms.ChatMessage,
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
 		}
+		m := MessageWithMetadata{}
 		switch messageType {
 		case string(llms.ChatMessageTypeAI):
-			messages = append(messages, llms.AIChatMessage{Content: content})
+			m.Message = llms.AIChatMessage{Content: content}
 		case string(llms.ChatMessageTypeHuman):
-			messages = append(messages, llms.HumanChatMessage{Content: content})
+			m.Message = llms.HumanChatMessage{Content: content}
 		case string(llms.ChatMessageTypeSystem):
-			messages = append(messages, llms.SystemChatMessage{Content: content})
+			m.Message = llms.SystemChatMessage{Content: content}
 		default:
 			return nil, fmt.Errorf("unsupported message type: %s", messageType)
 		}
+		if metadata != nil {
+			if err := json.Unmarshal(metadata, &m.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+			}
+		}
+		messages = append(messages, m)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -225,23 +409,15 @@ func (c *ChatMessageHistory) Messages(ctx context.Context) ([]llms.ChatMessage,
 }
 
 // SetMessages clears the current messages from the ChatMessageHistory for a
-// given session and then adds new messages to it.
+// given session and then adds new messages to it. Both steps run in a single
+// transaction, so a failure leaves the stored messages unchanged.
 func (c *ChatMessageHistory) SetMessages(ctx context.Context, messages []llms.ChatMessage) error {
-	err := c.Clear(ctx)
-	if err != nil {
-		return err
-	}
-
-	b := &pgx.Batch{}
-	query := fmt.Sprintf(`INSERT INTO %q.%q (session_id, data, type) VALUES ($1, $2, $3)`,
-		c.schemaName, c.tableName)
-
-	for _, message := range messages {
-		data, err := json.Marshal(message.GetContent())
-		if err != nil {
-			return fmt.Errorf("failed to serialize content to JSON: %w", err)
+	return pgx.BeginFunc(ctx, c.engine.Pool, func(tx pgx.Tx) error {
+		condition, args := c.sessionCondition()
+		query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, c.qualifiedTableName, condition)
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to clear session %s: %w", c.sessionID, err)
 		}
-		b.Queue(query, c.sessionID, data, message.GetType())
-	}
-	return c.engine.Pool.SendBatch(ctx, b).Close()
+		return c.insertMessages(ctx, tx, messages)
+	})
 }
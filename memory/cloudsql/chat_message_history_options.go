@@ -15,6 +15,16 @@ func WithSchemaName(schemaName string) ChatMessageHistoryStoresOption {
 	}
 }
 
+// WithUserID keys the messages by the given user as well as the session, so
+// that users sharing a session id do not see each other's messages. The table
+// must have the user_id column added by InitChatHistoryTable with
+// WithUserIDColumn.
+func WithUserID(userID string) ChatMessageHistoryStoresOption {
+	return func(c *ChatMessageHistory) {
+		c.userID = userID
+	}
+}
+
 // applyChatMessageHistoryOptions applies the given options to the
 // ChatMessageHistory.
 func applyChatMessageHistoryOptions(cmh ChatMessageHistory, opts ...ChatMessageHistoryStoresOption) ChatMessageHistory {
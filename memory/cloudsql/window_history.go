@@ -0,0 +1,30 @@
+package cloudsql
+
+import (
+	"context"
+
+	"github.com/averikitsch/langchaingo/llms"
+	"github.com/averikitsch/langchaingo/schema"
+)
+
+// WindowHistory is a chat message history that reads only the last messages
+// of a session, so that prompts built from it stay bounded while the full
+// conversation remains stored. Use it as the chat history of a
+// memory.ConversationBuffer. Writes go to the wrapped ChatMessageHistory.
+type WindowHistory struct {
+	*ChatMessageHistory
+	size int
+}
+
+var _ schema.ChatMessageHistory = &WindowHistory{}
+
+// NewWindowHistory creates a WindowHistory that reads the last size messages
+// of history. A non-positive size reads all messages.
+func NewWindowHistory(history *ChatMessageHistory, size int) *WindowHistory {
+	return &WindowHistory{ChatMessageHistory: history, size: size}
+}
+
+// Messages retrieves the last messages of the session in insertion order.
+func (w *WindowHistory) Messages(ctx context.Context) ([]llms.ChatMessage, error) {
+	return w.LastMessages(ctx, w.size)
+}
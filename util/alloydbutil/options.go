@@ -2,8 +2,14 @@ package alloydbutil
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/oauth2"
 )
 
 const (
@@ -11,6 +17,9 @@ const (
 	defaultUserAgent  = "langchaingo-alloydb-pg/0.0.0"
 )
 
+// sslModes are the sslmode values accepted by PostgreSQL.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
 // Option is a function type that can be used to modify the Engine.
 type Option func(p *engineConfig)
 
@@ -20,13 +29,32 @@ type engineConfig struct {
 	cluster         string
 	instance        string
 	connPool        *pgxpool.Pool
+	dsn             string
+	hosts           []string
+	sslMode         string
+	sslCertFile     string
+	sslKeyFile      string
+	sslRootCertFile string
 	database        string
 	user            string
 	password        string
 	ipType          string
 	iamAccountEmail string
 	emailRetriever  EmailRetriever
+	// tokenSource and credentialsJSON replace the application default
+	// credentials of the dialer and the IAM principal email lookup.
+	tokenSource     oauth2.TokenSource
+	credentialsJSON []byte
 	userAgents      string
+	queryHook       QueryHook
+	// logger receives the connection lifecycle events of the pool the
+	// engine creates. Nothing is logged when it is nil.
+	logger *slog.Logger
+	// queryExecMode overrides pgx's default query exec mode when set.
+	queryExecMode *pgx.QueryExecMode
+	// iamTokenRefreshInterval is how long before expiry IAM tokens are
+	// refreshed. Zero keeps the dialer's default refresh.
+	iamTokenRefreshInterval time.Duration
 }
 
 // VectorstoreTableOptions is used with the InitVectorstoreTable to use the required and default fields.
@@ -53,13 +81,58 @@ func WithAlloyDBInstance(projectID, region, cluster, instance string) Option {
 	}
 }
 
-// WithPool sets the Port field.
+// WithPool sets the connection pool used by the engine. The engine does not
+// manage authentication for a pool it did not create, so a long-lived pool
+// using IAM authentication should be built on an alloydbconn dialer created
+// with alloydbconn.WithIAMAuthN, which refreshes its tokens automatically.
 func WithPool(pool *pgxpool.Pool) Option {
 	return func(p *engineConfig) {
 		p.connPool = pool
 	}
 }
 
+// WithDSN sets a PostgreSQL connection string. The engine then connects
+// directly to the database, without the managed instance dialer, which is
+// useful for local development, CI and self-managed Postgres.
+func WithDSN(dsn string) Option {
+	return func(p *engineConfig) {
+		p.dsn = dsn
+	}
+}
+
+// WithSSLMode sets the sslmode of connections made with WithDSN, overriding
+// any sslmode in the DSN. It must be one of disable, allow, prefer, require,
+// verify-ca or verify-full. Connections through the managed AlloyDB dialer
+// are always encrypted by the dialer and ignore it.
+func WithSSLMode(sslMode string) Option {
+	return func(p *engineConfig) {
+		p.sslMode = sslMode
+	}
+}
+
+// WithSSLCertFiles sets the client certificate, client key and root
+// certificate files of connections made with WithDSN. Empty paths are left
+// unset.
+func WithSSLCertFiles(certFile, keyFile, rootCertFile string) Option {
+	return func(p *engineConfig) {
+		p.sslCertFile = certFile
+		p.sslKeyFile = keyFile
+		p.sslRootCertFile = rootCertFile
+	}
+}
+
+// WithHosts connects directly to the first writable server among the given
+// hosts, each given as "host" or "host:port", without the managed instance
+// dialer. Hosts are tried in order with target_session_attrs=read-write, so
+// the pool fails over to the new primary of a high-availability cluster. The
+// user, password and database are taken from WithUser, WithPassword and
+// WithDatabase. It cannot be combined with WithPool or WithDSN.
+func WithHosts(hosts []string) Option {
+	return func(p *engineConfig) {
+		p.hosts = hosts
+	}
+}
+
 // WithDatabase sets the Database field.
 func WithDatabase(database string) Option {
 	return func(p *engineConfig) {
@@ -95,6 +168,69 @@ func WithIAMAccountEmail(email string) Option {
 	}
 }
 
+// WithIAMTokenRefreshInterval refreshes the IAM tokens used by the engine's
+// dialer the given duration before they expire, rather than relying on the
+// dialer's default refresh. It only applies when the engine creates the pool
+// with IAM authentication. A token source set with WithTokenSource must then
+// return a new token on every call rather than caching it.
+func WithIAMTokenRefreshInterval(interval time.Duration) Option {
+	return func(p *engineConfig) {
+		p.iamTokenRefreshInterval = interval
+	}
+}
+
+// WithTokenSource sets the token source used instead of the application
+// default credentials, both by the dialer and to look up the IAM principal
+// email when no user is given. Its tokens must carry the cloud-platform scope,
+// and the userinfo.email scope for the email lookup. It cannot be combined
+// with WithCredentialsJSON.
+func WithTokenSource(ts oauth2.TokenSource) Option {
+	return func(p *engineConfig) {
+		p.tokenSource = ts
+	}
+}
+
+// WithCredentialsJSON sets the JSON service account key or other credentials
+// file content used instead of the application default credentials, both by
+// the dialer and to look up the IAM principal email when no user is given.
+// It cannot be combined with WithTokenSource.
+func WithCredentialsJSON(credentialsJSON []byte) Option {
+	return func(p *engineConfig) {
+		p.credentialsJSON = credentialsJSON
+	}
+}
+
+// WithQueryHook sets a hook called around every statement run by the pool
+// the engine creates, including those of the vector store and chat message
+// history built on the engine. It cannot be combined with WithPool; install
+// a pgx tracer on such a pool instead.
+func WithQueryHook(hook QueryHook) Option {
+	return func(p *engineConfig) {
+		p.queryHook = hook
+	}
+}
+
+// WithLogger logs, at debug level, the creation of the pool the engine
+// creates, connections being opened, acquired, released and closed with the
+// time spent waiting for and holding them, and errors dialing the database.
+// Nothing is logged by default. It cannot be combined with WithPool.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *engineConfig) {
+		p.logger = logger
+	}
+}
+
+// WithDefaultQueryExecMode sets how the pool the engine creates executes
+// queries. pgx prepares and caches statements by default, which breaks behind
+// poolers such as PgBouncer in transaction mode; use
+// pgx.QueryExecModeExec or pgx.QueryExecModeSimpleProtocol there. It cannot
+// be combined with WithPool; set the mode on such a pool's config instead.
+func WithDefaultQueryExecMode(mode pgx.QueryExecMode) Option {
+	return func(p *engineConfig) {
+		p.queryExecMode = &mode
+	}
+}
+
 func applyClientOptions(opts ...Option) (engineConfig, error) {
 	cfg := &engineConfig{
 		emailRetriever: getServiceAccountEmail,
@@ -104,7 +240,31 @@ func applyClientOptions(opts ...Option) (engineConfig, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	if cfg.connPool == nil && cfg.projectID == "" && cfg.region == "" && cfg.cluster == "" && cfg.instance == "" {
+	if cfg.tokenSource != nil && cfg.credentialsJSON != nil {
+		return engineConfig{}, errors.New("WithTokenSource cannot be combined with WithCredentialsJSON")
+	}
+	if cfg.tokenSource != nil || cfg.credentialsJSON != nil {
+		cfg.emailRetriever = credentialsEmailRetriever(*cfg)
+	}
+	if cfg.connPool != nil && cfg.queryHook != nil {
+		return engineConfig{}, errors.New("a query hook cannot be added to a pool passed with WithPool")
+	}
+	if cfg.connPool != nil && cfg.logger != nil {
+		return engineConfig{}, errors.New("a logger cannot be added to a pool passed with WithPool")
+	}
+	if cfg.connPool != nil && cfg.queryExecMode != nil {
+		return engineConfig{}, errors.New("a query exec mode cannot be set on a pool passed with WithPool")
+	}
+	if cfg.sslMode != "" && !slices.Contains(sslModes, cfg.sslMode) {
+		return engineConfig{}, fmt.Errorf("invalid sslmode %q", cfg.sslMode)
+	}
+	if len(cfg.hosts) > 0 {
+		if cfg.connPool != nil || cfg.dsn != "" {
+			return engineConfig{}, errors.New("hosts cannot be combined with WithPool or WithDSN")
+		}
+		cfg.dsn = multiHostDSN(*cfg)
+	}
+	if cfg.connPool == nil && cfg.dsn == "" && cfg.projectID == "" && cfg.region == "" && cfg.cluster == "" && cfg.instance == "" {
 		return engineConfig{}, errors.New("missing connection: provide a connection pool or connection fields")
 	}
 
@@ -116,7 +276,10 @@ type OptionInitChatHistoryTable func(*InitChatHistoryTableOptions)
 
 // Option type for defining options.
 type InitChatHistoryTableOptions struct {
-	schemaName string
+	schemaName        string
+	metadataColumn    bool
+	userIDColumn      bool
+	overwriteExisting bool
 }
 
 // WithSchemaName sets a custom schema name.
@@ -126,6 +289,31 @@ func WithSchemaName(schemaName string) OptionInitChatHistoryTable {
 	}
 }
 
+// WithMetadataColumn adds a JSONB metadata column for per-message metadata.
+// The column is also added to an existing table that lacks it.
+func WithMetadataColumn() OptionInitChatHistoryTable {
+	return func(i *InitChatHistoryTableOptions) {
+		i.metadataColumn = true
+	}
+}
+
+// WithUserIDColumn adds a user_id column so that messages can be keyed by
+// user as well as session. The column is also added to an existing table that
+// lacks it.
+func WithUserIDColumn() OptionInitChatHistoryTable {
+	return func(i *InitChatHistoryTableOptions) {
+		i.userIDColumn = true
+	}
+}
+
+// WithOverwriteExisting drops an existing chat history table and creates it
+// again, deleting all stored messages.
+func WithOverwriteExisting() OptionInitChatHistoryTable {
+	return func(i *InitChatHistoryTableOptions) {
+		i.overwriteExisting = true
+	}
+}
+
 // applyChatMessageHistoryOptions applies the given options to the
 // ChatMessageHistory.
 func applyChatMessageHistoryOptions(opts ...OptionInitChatHistoryTable) InitChatHistoryTableOptions {
@@ -0,0 +1,58 @@
+package alloydbutil
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryHook is called before the engine's pool runs a SQL statement. The
+// returned function, which may be nil, is called with the statement's error
+// once it completes. Hooks can start OpenTelemetry spans, record Prometheus
+// timers or log slow queries.
+type QueryHook func(ctx context.Context, sql string) func(err error)
+
+// queryHookDoneKey is the context key of the completion callback of the
+// statement being traced.
+type queryHookDoneKey struct{}
+
+// queryTracer adapts a QueryHook to pgx's query and batch tracers. A tracer
+// without a hook traces nothing.
+type queryTracer struct {
+	hook QueryHook
+}
+
+var (
+	_ pgx.QueryTracer = queryTracer{}
+	_ pgx.BatchTracer = queryTracer{}
+)
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.hook == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, queryHookDoneKey{}, t.hook(ctx, data.SQL))
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if done, ok := ctx.Value(queryHookDoneKey{}).(func(error)); ok && done != nil {
+		done(data.Err)
+	}
+}
+
+func (t queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return ctx
+}
+
+// TraceBatchQuery reports each statement of a batch once its result has been
+// read, as pgx does not trace the start of individual batched statements.
+func (t queryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if t.hook == nil {
+		return
+	}
+	if done := t.hook(ctx, data.SQL); done != nil {
+		done(data.Err)
+	}
+}
+
+func (t queryTracer) TraceBatchEnd(context.Context, *pgx.Conn, pgx.TraceBatchEndData) {}
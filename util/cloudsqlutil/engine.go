@@ -5,9 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 
 	"cloud.google.com/go/cloudsqlconn"
+	"github.com/averikitsch/langchaingo/internal/sqlutil"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	xoauth2 "golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
@@ -25,6 +29,15 @@ type Column struct {
 	Nullable bool
 }
 
+// TableInfo describes a vector column of a table, as listed by
+// ListVectorstoreTables. Dimensions is zero for a column declared without a
+// dimension.
+type TableInfo struct {
+	TableName    string
+	VectorColumn string
+	Dimensions   int
+}
+
 // NewPostgresEngine creates a new PostgresEngine.
 func NewPostgresEngine(ctx context.Context, opts ...Option) (PostgresEngine, error) {
 	pgEngine := new(PostgresEngine)
@@ -32,6 +45,12 @@ func NewPostgresEngine(ctx context.Context, opts ...Option) (PostgresEngine, err
 	if err != nil {
 		return PostgresEngine{}, err
 	}
+	if cfg.connPool == nil && cfg.dsn != "" {
+		cfg.connPool, err = createPoolFromDSN(ctx, cfg.dsn, cfg)
+		if err != nil {
+			return PostgresEngine{}, err
+		}
+	}
 	if cfg.connPool == nil {
 		user, usingIAMAuth, err := getUser(ctx, cfg)
 		if err != nil {
@@ -57,6 +76,14 @@ func createPool(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (*pgxp
 		dialerOpts = append(dialerOpts, cloudsqlconn.WithIAMAuthN())
 		dsn = fmt.Sprintf("user=%s dbname=%s sslmode=disable", cfg.user, cfg.database)
 	}
+	switch {
+	case cfg.credentialsJSON != nil:
+		dialerOpts = append(dialerOpts, cloudsqlconn.WithCredentialsJSON(cfg.credentialsJSON))
+	case cfg.tokenSource != nil && usingIAMAuth:
+		dialerOpts = append(dialerOpts, cloudsqlconn.WithIAMAuthNTokenSources(cfg.tokenSource, cfg.tokenSource))
+	case cfg.tokenSource != nil:
+		dialerOpts = append(dialerOpts, cloudsqlconn.WithTokenSource(cfg.tokenSource))
+	}
 
 	d, err := cloudsqlconn.NewDialer(ctx, dialerOpts...)
 	if err != nil {
@@ -75,10 +102,73 @@ func createPool(ctx context.Context, cfg engineConfig, usingIAMAuth bool) (*pgxp
 		}
 		return d.Dial(ctx, instanceURI, cloudsqlconn.WithPublicIP())
 	}
+	configureConnConfig(config.ConnConfig, cfg)
+	configurePoolLogging(config, cfg)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+	logPoolCreated(ctx, config, cfg)
+	return pool, nil
+}
+
+// configureConnConfig applies the engine options that apply to every
+// connection of a pool the engine creates.
+func configureConnConfig(config *pgx.ConnConfig, cfg engineConfig) {
+	if cfg.queryHook != nil {
+		config.Tracer = queryTracer{hook: cfg.queryHook}
+	}
+	if cfg.queryExecMode != nil {
+		config.DefaultQueryExecMode = *cfg.queryExecMode
+	}
+}
+
+// dsnValueEscaper escapes a value quoted in a keyword/value DSN.
+var dsnValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// multiHostDSN returns a keyword/value DSN connecting to the first writable
+// server among the hosts set by WithHosts. Hosts without a port use 5432.
+func multiHostDSN(cfg engineConfig) string {
+	hosts := make([]string, len(cfg.hosts))
+	ports := make([]string, len(cfg.hosts))
+	for i, hostPort := range cfg.hosts {
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			host, port = hostPort, "5432"
+		}
+		hosts[i], ports[i] = host, port
+	}
+	params := [][2]string{
+		{"host", strings.Join(hosts, ",")},
+		{"port", strings.Join(ports, ",")},
+		{"user", cfg.user},
+		{"password", cfg.password},
+		{"dbname", cfg.database},
+		{"target_session_attrs", "read-write"},
+	}
+	var dsn []string
+	for _, param := range params {
+		if param[1] != "" {
+			dsn = append(dsn, fmt.Sprintf("%s='%s'", param[0], dsnValueEscaper.Replace(param[1])))
+		}
+	}
+	return strings.Join(dsn, " ")
+}
+
+// createPoolFromDSN creates a connection pool from a connection string,
+// bypassing the managed instance dialer.
+func createPoolFromDSN(ctx context.Context, dsn string, cfg engineConfig) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection config: %w", err)
+	}
+	configureConnConfig(config.ConnConfig, cfg)
+	configurePoolLogging(config, cfg)
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
+	logPoolCreated(ctx, config, cfg)
 	return pool, nil
 }
 
@@ -89,6 +179,27 @@ func (p *PostgresEngine) Close() {
 	}
 }
 
+// CloseContext closes the connection pool after in-flight queries have
+// released their connections, waiting at most until ctx is done. New queries
+// are rejected immediately. If ctx is done first, the context error is
+// returned and the pool finishes closing in the background.
+func (p *PostgresEngine) CloseContext(ctx context.Context) error {
+	if p.Pool == nil {
+		return nil
+	}
+	closed := make(chan struct{})
+	go func() {
+		p.Pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to close connection pool: %w", ctx.Err())
+	}
+}
+
 // getUser retrieves the username, a flag indicating if IAM authentication
 // will be used and an error.
 func getUser(ctx context.Context, config engineConfig) (string, bool, error) {
@@ -113,11 +224,44 @@ func getUser(ctx context.Context, config engineConfig) (string, bool, error) {
 	return "", false, errors.New("unable to retrieve a valid username")
 }
 
+// userInfoEmailScope is the scope needed to look up the email of an IAM
+// principal.
+const userInfoEmailScope = "https://www.googleapis.com/auth/userinfo.email"
+
+// credentialsTokenSource returns the token source set with WithTokenSource,
+// or one requesting the given scopes for the credentials set with
+// WithCredentialsJSON. It returns nil when neither is set.
+func credentialsTokenSource(ctx context.Context, cfg engineConfig, scopes ...string) (xoauth2.TokenSource, error) {
+	switch {
+	case cfg.tokenSource != nil:
+		return cfg.tokenSource, nil
+	case cfg.credentialsJSON != nil:
+		credentials, err := google.CredentialsFromJSON(ctx, cfg.credentialsJSON, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse credentials JSON: %w", err)
+		}
+		return credentials.TokenSource, nil
+	}
+	return nil, nil
+}
+
+// credentialsEmailRetriever returns an EmailRetriever looking up the IAM
+// principal of the credentials set with WithTokenSource or
+// WithCredentialsJSON.
+func credentialsEmailRetriever(cfg engineConfig) EmailRetriever {
+	return func(ctx context.Context) (string, error) {
+		ts, err := credentialsTokenSource(ctx, cfg, userInfoEmailScope)
+		if err != nil {
+			return "", err
+		}
+		return tokenSourceEmail(ctx, ts)
+	}
+}
+
 // getServiceAccountEmail retrieves the IAM principal email with users account.
 func getServiceAccountEmail(ctx context.Context) (string, error) {
-	scopes := []string{"https://www.googleapis.com/auth/userinfo.email"}
 	// Get credentials using email scope
-	credentials, err := google.FindDefaultCredentials(ctx, scopes...)
+	credentials, err := google.FindDefaultCredentials(ctx, userInfoEmailScope)
 	if err != nil {
 		return "", fmt.Errorf("unable to get default credentials: %w", err)
 	}
@@ -126,8 +270,13 @@ func getServiceAccountEmail(ctx context.Context) (string, error) {
 	if credentials.TokenSource == nil {
 		return "", fmt.Errorf("missing or invalid credentials")
 	}
+	return tokenSourceEmail(ctx, credentials.TokenSource)
+}
 
-	oauth2Service, err := oauth2.NewService(ctx, option.WithTokenSource(credentials.TokenSource))
+// tokenSourceEmail retrieves the email of the IAM principal that the tokens
+// of ts belong to.
+func tokenSourceEmail(ctx context.Context, ts xoauth2.TokenSource, opts ...option.ClientOption) (string, error) {
+	oauth2Service, err := oauth2.NewService(ctx, append([]option.ClientOption{option.WithTokenSource(ts)}, opts...)...)
 	if err != nil {
 		return "", fmt.Errorf("failed to create new service: %w", err)
 	}
@@ -162,7 +311,11 @@ func validateVectorstoreTableOptions(opts *VectorstoreTableOptions) error {
 		opts.EmbeddingColumn = "embedding"
 	}
 
-	if opts.MetadataJSONColumn == "" {
+	// The JSON metadata column only exists when metadata is stored, so the
+	// effective name is empty otherwise.
+	if !opts.StoreMetadata {
+		opts.MetadataJSONColumn = ""
+	} else if opts.MetadataJSONColumn == "" {
 		opts.MetadataJSONColumn = "langchain_metadata"
 	}
 
@@ -177,11 +330,22 @@ func validateVectorstoreTableOptions(opts *VectorstoreTableOptions) error {
 	return nil
 }
 
-// initVectorstoreTable creates a table for saving of vectors to be used with PostgresVectorStore.
+// EffectiveVectorstoreTableOptions returns opts with the defaults that
+// InitVectorstoreTable applies, so the column names of a table created with
+// opts can be passed on to the vector store.
+func EffectiveVectorstoreTableOptions(opts VectorstoreTableOptions) (VectorstoreTableOptions, error) {
+	if err := validateVectorstoreTableOptions(&opts); err != nil {
+		return VectorstoreTableOptions{}, fmt.Errorf("failed to validate vectorstore table options: %w", err)
+	}
+	return opts, nil
+}
+
+// InitVectorstoreTable creates a table for saving of vectors to be used with PostgresVectorStore.
+// Its column names are those of EffectiveVectorstoreTableOptions(opts).
 func (p *PostgresEngine) InitVectorstoreTable(ctx context.Context, opts VectorstoreTableOptions) error {
-	err := validateVectorstoreTableOptions(&opts)
+	opts, err := EffectiveVectorstoreTableOptions(opts)
 	if err != nil {
-		return fmt.Errorf("failed to validate vectorstore table options: %w", err)
+		return err
 	}
 
 	// Ensure the vector extension exists
@@ -229,21 +393,127 @@ func (p *PostgresEngine) InitVectorstoreTable(ctx context.Context, opts Vectorst
 	return nil
 }
 
-// initChatHistoryTable creates a table to store chat history.
+// ListVectorstoreTables lists the tables of the schema that have a pgvector
+// vector column, with one entry per vector column, ordered by table and
+// column name. An empty schemaName lists the public schema.
+func (p *PostgresEngine) ListVectorstoreTables(ctx context.Context, schemaName string) ([]TableInfo, error) {
+	if schemaName == "" {
+		schemaName = defaultSchemaName
+	}
+	// The type modifier of a vector column is its dimension, or -1 when the
+	// column was declared without one.
+	query := `SELECT c.relname, a.attname, GREATEST(a.atttypmod, 0)
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND t.typname = 'vector'
+			AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attname`
+	rows, err := p.Pool.Query(ctx, query, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectorstore tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []TableInfo
+	for rows.Next() {
+		var table TableInfo
+		if err := rows.Scan(&table.TableName, &table.VectorColumn, &table.Dimensions); err != nil {
+			return nil, fmt.Errorf("failed to scan vectorstore table: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list vectorstore tables: %w", err)
+	}
+	return tables, nil
+}
+
+// InitChatHistoryTable creates a table to store chat history. An existing
+// table is kept unless WithOverwriteExisting is given, and is checked for the
+// required columns.
 func (p *PostgresEngine) InitChatHistoryTable(ctx context.Context, tableName string, opts ...OptionInitChatHistoryTable) error {
 	cfg := applyChatMessageHistoryOptions(opts...)
 
-	createTableQuery := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s"."%s" (
+	qualifiedTableName, err := sqlutil.QuoteQualifiedIdentifier(cfg.schemaName, tableName)
+	if err != nil {
+		return fmt.Errorf("invalid chat history table: %w", err)
+	}
+
+	if cfg.overwriteExisting {
+		_, err = p.Pool.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, qualifiedTableName))
+		if err != nil {
+			return fmt.Errorf("failed to drop table: %w", err)
+		}
+	}
+
+	createTableQuery := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
 		id SERIAL PRIMARY KEY,
 		session_id TEXT NOT NULL,
 		data JSONB NOT NULL,
 		type TEXT NOT NULL
-	);`, cfg.schemaName, tableName)
+	);`, qualifiedTableName)
 
 	// Execute the query
-	_, err := p.Pool.Exec(ctx, createTableQuery)
+	_, err = p.Pool.Exec(ctx, createTableQuery)
 	if err != nil {
 		return fmt.Errorf("failed to execute query: %w", err)
 	}
+
+	if cfg.metadataColumn {
+		_, err = p.Pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS metadata JSONB`, qualifiedTableName))
+		if err != nil {
+			return fmt.Errorf("failed to add metadata column: %w", err)
+		}
+	}
+	if cfg.userIDColumn {
+		_, err = p.Pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS user_id TEXT`, qualifiedTableName))
+		if err != nil {
+			return fmt.Errorf("failed to add user_id column: %w", err)
+		}
+	}
+	return p.validateChatHistoryTable(ctx, cfg.schemaName, tableName)
+}
+
+// validateChatHistoryTable checks that a chat history table has the required
+// columns with the expected types.
+func (p *PostgresEngine) validateChatHistoryTable(ctx context.Context, schemaName, tableName string) error {
+	requiredColumns := map[string]string{
+		"id":         "integer",
+		"session_id": "text",
+		"data":       "jsonb",
+		"type":       "text",
+	}
+
+	rows, err := p.Pool.Query(ctx, `SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2`, schemaName, tableName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch chat history table columns: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var columnName, dataType string
+		if err := rows.Scan(&columnName, &dataType); err != nil {
+			return fmt.Errorf("failed to scan chat history table columns: %w", err)
+		}
+		columns[columnName] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch chat history table columns: %w", err)
+	}
+
+	for column, expectedType := range requiredColumns {
+		actualType, ok := columns[column]
+		if !ok {
+			return fmt.Errorf("chat history table %q is missing column %q", tableName, column)
+		}
+		if actualType != expectedType {
+			return fmt.Errorf("chat history table %q column %q has type %q, expected %q",
+				tableName, column, actualType, expectedType)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,93 @@
+package cloudsqlutil
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// acquireStartKey is the context key of the start time of the connection
+// acquisition being traced.
+type acquireStartKey struct{}
+
+// loggingTracer logs the acquisition and release of pool connections at debug
+// level, passing statements on to the embedded query tracer, whose hook may
+// be nil.
+type loggingTracer struct {
+	queryTracer
+	logger *slog.Logger
+	// acquired holds the acquisition time of each connection in use.
+	acquired sync.Map
+}
+
+var (
+	_ pgxpool.AcquireTracer = (*loggingTracer)(nil)
+	_ pgxpool.ReleaseTracer = (*loggingTracer)(nil)
+)
+
+func (t *loggingTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return context.WithValue(ctx, acquireStartKey{}, time.Now())
+}
+
+func (t *loggingTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	start, _ := ctx.Value(acquireStartKey{}).(time.Time)
+	wait := time.Since(start)
+	if data.Err != nil {
+		t.logger.DebugContext(ctx, "failed to acquire connection", "wait", wait, "error", data.Err)
+		return
+	}
+	t.acquired.Store(data.Conn, time.Now())
+	t.logger.DebugContext(ctx, "acquired connection", "pid", data.Conn.PgConn().PID(), "wait", wait)
+}
+
+func (t *loggingTracer) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	attrs := []any{"pid", data.Conn.PgConn().PID()}
+	if acquired, ok := t.acquired.LoadAndDelete(data.Conn); ok {
+		attrs = append(attrs, "held", time.Since(acquired.(time.Time)))
+	}
+	t.logger.Debug("released connection", attrs...)
+}
+
+// configurePoolLogging makes a pool the engine creates log connection
+// lifecycle events and dial errors to the WithLogger logger. It must be
+// called once the rest of the pool config is set.
+func configurePoolLogging(config *pgxpool.Config, cfg engineConfig) {
+	if cfg.logger == nil {
+		return
+	}
+	logger := cfg.logger
+	tracer := &loggingTracer{logger: logger}
+	if qt, ok := config.ConnConfig.Tracer.(queryTracer); ok {
+		tracer.queryTracer = qt
+	}
+	config.ConnConfig.Tracer = tracer
+
+	dial := config.ConnConfig.DialFunc
+	config.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			logger.DebugContext(ctx, "failed to dial database", "network", network, "addr", addr, "error", err)
+		}
+		return conn, err
+	}
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		logger.DebugContext(ctx, "opened connection", "pid", conn.PgConn().PID())
+		return nil
+	}
+	config.BeforeClose = func(conn *pgx.Conn) {
+		logger.Debug("closed connection", "pid", conn.PgConn().PID())
+	}
+}
+
+// logPoolCreated logs the creation of a pool with the given config.
+func logPoolCreated(ctx context.Context, config *pgxpool.Config, cfg engineConfig) {
+	if cfg.logger != nil {
+		cfg.logger.DebugContext(ctx, "created connection pool",
+			"host", config.ConnConfig.Host, "database", config.ConnConfig.Database, "max_conns", config.MaxConns)
+	}
+}
@@ -0,0 +1,117 @@
+package alloydb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/averikitsch/langchaingo/schema"
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+)
+
+// EmbeddingMetadataKey is the metadata key under which ExportAll returns the
+// embedding of each document as a []float32.
+const EmbeddingMetadataKey = "_embedding"
+
+// ExportAll streams every document of the store's table, for backups or
+// migrations to another store. Documents are read in pages of batchSize rows
+// ordered by id, each page resuming after the last id of the previous one, so
+// that no query holds more than one page. Each document carries its id under
+// the "id" metadata key and its embedding under EmbeddingMetadataKey. Taking
+// the embedding out of the metadata, the document can be added again with
+// the same id through AddVectors. A query or scan error is yielded with an
+// empty document and ends the iteration. The returned function is an
+// iter.Seq2[schema.Document, error] for ranging over with Go 1.23 or later.
+func (vs *VectorStore) ExportAll(ctx context.Context, batchSize int) (func(yield func(schema.Document, error) bool), error) {
+	if batchSize <= 0 {
+		return nil, errors.New("batch size must be greater than zero")
+	}
+	return func(yield func(schema.Document, error) bool) {
+		var lastID any
+		for {
+			n, last, ok := vs.exportPage(ctx, batchSize, lastID, yield)
+			if !ok || n < batchSize {
+				return
+			}
+			lastID = last
+		}
+	}, nil
+}
+
+// exportPage yields the documents of the page of at most batchSize rows
+// following lastID, or the first page when lastID is nil. It returns the
+// number of rows read, the id of the last row and whether iteration should
+// continue.
+func (vs *VectorStore) exportPage(ctx context.Context, batchSize int, lastID any,
+	yield func(schema.Document, error) bool,
+) (int, any, bool) {
+	metadataJSON := "'{}'"
+	if vs.metadataJSONColumn != "" {
+		metadataJSON = vs.metadataJSONColumn
+	}
+	args := []any{batchSize}
+	whereClause := ""
+	if lastID != nil {
+		args = append(args, lastID)
+		whereClause = fmt.Sprintf("WHERE %s > $2", vs.idColumn)
+	}
+	stmt := fmt.Sprintf(`SELECT %s, %s::text, %s, %s, %s::text%s FROM "%s"."%s" %s ORDER BY %s LIMIT $1::int`,
+		vs.idColumn, vs.idColumn, vs.contentColumn, metadataJSON, vs.embeddingColumn, vs.metadataColumnsSelect(),
+		vs.schemaName, vs.tableName, whereClause, vs.idColumn)
+	rows, err := vs.engine.Pool.Query(ctx, stmt, args...)
+	if err != nil {
+		yield(schema.Document{}, fmt.Errorf("failed to export documents: %w", err))
+		return 0, nil, false
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+		doc, id, err := vs.scanExportDocument(rows)
+		if !yield(doc, err) || err != nil {
+			return n, nil, false
+		}
+		lastID = id
+	}
+	if err := rows.Err(); err != nil {
+		yield(schema.Document{}, fmt.Errorf("rows iteration error: %w", err))
+		return n, nil, false
+	}
+	return n, lastID, true
+}
+
+// scanExportDocument scans the current row of an export into a document and
+// returns it along with the row's id value.
+func (vs *VectorStore) scanExportDocument(rows pgx.Rows) (schema.Document, any, error) {
+	var id, content any
+	var idText string
+	var embedding *string
+	result := SearchDocument{}
+	columnValues := make([]any, len(vs.metadataColumns))
+	dest := []any{&id, &idText, &content, &result.LangchainMetadata, &embedding}
+	for i := range columnValues {
+		dest = append(dest, &columnValues[i])
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return schema.Document{}, nil, fmt.Errorf("failed to scan result: %w", err)
+	}
+	var err error
+	if result.Content, err = contentText(content); err != nil {
+		return schema.Document{}, nil, err
+	}
+	result.MetadataColumns = vs.metadataColumnValues(columnValues)
+	metadata, err := resultMetadata(result)
+	if err != nil {
+		return schema.Document{}, nil, err
+	}
+	metadata["id"] = idText
+	if embedding != nil {
+		var vector pgvector.Vector
+		if err := vector.Parse(*embedding); err != nil {
+			return schema.Document{}, nil, fmt.Errorf("failed to parse embedding: %w", err)
+		}
+		metadata[EmbeddingMetadataKey] = vector.Slice()
+	}
+	return schema.Document{PageContent: result.Content, Metadata: metadata}, id, nil
+}
@@ -0,0 +1,84 @@
+package alloydb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMetadataFilter is returned when a MetadataFilter cannot be
+// translated to SQL.
+var ErrInvalidMetadataFilter = errors.New("invalid metadata filter")
+
+// MetadataFilter restricts a search to documents whose value for JSONKey in
+// the metadata JSON column compares to Value with Op. String values support
+// the "=" and "!=" operators, numeric values also support "<", "<=", ">" and
+// ">=". Pass a MetadataFilter, a *MetadataFilter or a []MetadataFilter, whose
+// filters must all match, to vectorstores.WithFilters.
+type MetadataFilter struct {
+	JSONKey string
+	Op      string
+	Value   any
+}
+
+// filterCondition translates the Filters search option to a WHERE condition.
+// Metadata filters are bound as query arguments appended to args, and a
+// string filter is used as a raw SQL condition. A nil, blank or empty filter
+// yields an empty condition; a filter of any other type is rejected with
+// ErrInvalidMetadataFilter.
+func (vs *VectorStore) filterCondition(filters any, args []any) (string, []any, error) {
+	var metadataFilters []MetadataFilter
+	switch f := filters.(type) {
+	case nil:
+		return "", args, nil
+	case string:
+		if strings.TrimSpace(f) == "" {
+			return "", args, nil
+		}
+		return fmt.Sprintf("(%s)", f), args, nil
+	case MetadataFilter:
+		metadataFilters = []MetadataFilter{f}
+	case *MetadataFilter:
+		if f == nil {
+			return "", args, nil
+		}
+		metadataFilters = []MetadataFilter{*f}
+	case []MetadataFilter:
+		metadataFilters = f
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported filter type %T", ErrInvalidMetadataFilter, filters)
+	}
+	if len(metadataFilters) == 0 {
+		return "", args, nil
+	}
+	if vs.metadataJSONColumn == "" {
+		return "", nil, fmt.Errorf("%w: store has no metadata JSON column", ErrInvalidMetadataFilter)
+	}
+
+	conditions := make([]string, 0, len(metadataFilters))
+	for _, f := range metadataFilters {
+		if f.JSONKey == "" {
+			return "", nil, fmt.Errorf("%w: missing JSON key", ErrInvalidMetadataFilter)
+		}
+		cast := ""
+		switch f.Value.(type) {
+		case string:
+			if f.Op != "=" && f.Op != "!=" {
+				return "", nil, fmt.Errorf("%w: operator %q is not supported for string values", ErrInvalidMetadataFilter, f.Op)
+			}
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			switch f.Op {
+			case "=", "!=", "<", "<=", ">", ">=":
+			default:
+				return "", nil, fmt.Errorf("%w: operator %q is not supported for numeric values", ErrInvalidMetadataFilter, f.Op)
+			}
+			cast = "::numeric"
+		default:
+			return "", nil, fmt.Errorf("%w: unsupported value type %T for key %q", ErrInvalidMetadataFilter, f.Value, f.JSONKey)
+		}
+		args = append(args, f.JSONKey, f.Value)
+		conditions = append(conditions, fmt.Sprintf("(%s->>$%d)%s %s $%d",
+			vs.metadataJSONColumn, len(args)-1, cast, f.Op, len(args)))
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
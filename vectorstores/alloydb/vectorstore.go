@@ -3,10 +3,16 @@ package alloydb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/averikitsch/langchaingo/embeddings"
+	"github.com/averikitsch/langchaingo/internal/sqlutil"
 	"github.com/averikitsch/langchaingo/schema"
 	"github.com/averikitsch/langchaingo/util/alloydbutil"
 	"github.com/averikitsch/langchaingo/vectorstores"
@@ -17,8 +23,15 @@ import (
 
 const (
 	defaultIndexNameSuffix = "langchainvectorindex"
+	// maxIndexNameLength is the number of bytes of an index name Postgres
+	// keeps (NAMEDATALEN - 1).
+	maxIndexNameLength = 63
 )
 
+// VectorStore stores documents and their embeddings in a table of a AlloyDB for PostgreSQL
+// database. It is safe for concurrent use by multiple goroutines: its methods
+// only read the store's configuration and the documents passed to them, and
+// share the engine's connection pool.
 type VectorStore struct {
 	engine             alloydbutil.PostgresEngine
 	embedder           embeddings.Embedder
@@ -31,6 +44,59 @@ type VectorStore struct {
 	metadataColumns    []string
 	k                  int
 	distanceStrategy   distanceStrategy
+	transactional      bool
+	connCheckOnSearch  bool
+	tenantColumn       string
+	// deduplicate skips adding documents whose content is already stored.
+	deduplicate bool
+	// poolAcquireTimeout, when positive, bounds how long a search waits for
+	// a connection from the pool.
+	poolAcquireTimeout time.Duration
+	// efSearch and probes, when positive, are the hnsw.ef_search and
+	// ivfflat.probes set for searches.
+	efSearch int
+	probes   int
+	// contentCast is the type the content value is cast to on insert, such
+	// as citext. When empty the value is not cast.
+	contentCast string
+	// embeddingDimension is the dimension added embeddings must have. When
+	// zero, it is detected from the embedding column of each table and cached
+	// in columnDimension, which is shared by copies of the store.
+	embeddingDimension int
+	columnDimension    *dimensionCache
+	// sparseEmbeddingColumn is the sparsevec column used by AddSparseVectors
+	// and SparseSimilaritySearch, holding vectors of sparseDimensions.
+	sparseEmbeddingColumn string
+	sparseDimensions      int
+	// idGenerator derives the id of documents without a string "id"
+	// metadata value.
+	idGenerator func(doc schema.Document) (string, error)
+	// tenant is the tenant a store returned by nameSpaceStore is scoped to.
+	tenant string
+	// acquireConn overrides how searches acquire their own connection. When
+	// nil, connections are acquired from the engine pool.
+	acquireConn func(ctx context.Context) (searchConn, error)
+}
+
+// searchQuerier is the subset of *pgxpool.Pool and *pgxpool.Conn used to run
+// a search.
+type searchQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// searchConn is the subset of *pgxpool.Conn used to run a checked search.
+type searchConn interface {
+	searchQuerier
+	Ping(ctx context.Context) error
+	Release()
+}
+
+// dimensionCache holds the detected dimension of the embedding column by
+// table name.
+type dimensionCache struct {
+	mu         sync.Mutex
+	dimensions map[string]int
 }
 
 type BaseIndex struct {
@@ -45,11 +111,58 @@ type SearchDocument struct {
 	Content           string
 	LangchainMetadata string
 	Distance          float32
+	// MetadataColumns holds the non-NULL values of the store's metadata
+	// columns, keyed by column name.
+	MetadataColumns map[string]any
 }
 
+// DistanceMetadataKey is the metadata key under which search results carry the
+// raw pgvector distance of the configured distance strategy. The document
+// Score holds the matching similarity, where higher means more similar.
+const DistanceMetadataKey = "_distance"
+
+var (
+	ErrInvalidScoreThreshold = errors.New("score threshold must be between 0 and 1")
+	ErrUnsupportedOptions    = errors.New("unsupported options")
+	// ErrMissingEmbedder is returned by methods that need to embed text when
+	// the store was created without an embedder.
+	ErrMissingEmbedder = errors.New("vector store has no embedder")
+	// ErrMissingTenant is returned when a store with a tenant column is used
+	// without a WithNameSpace option naming the tenant.
+	ErrMissingTenant = errors.New("missing tenant namespace")
+	// ErrEmbedderWrongNumberVectors is returned when the number of vectors
+	// does not match the number of documents.
+	ErrEmbedderWrongNumberVectors = errors.New("number of vectors does not match number of documents")
+	// ErrIndexNotFound is returned when reindexing an index that does not
+	// exist on the store's table.
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrIndexStrategyMismatch is returned by ValidateIndexStrategy when an
+	// index on the embedding column uses an operator class that does not
+	// match the store's distance strategy.
+	ErrIndexStrategyMismatch = errors.New("index operator class does not match distance strategy")
+	// ErrTableNotFound is returned by VerifyTable when the store's table does
+	// not exist.
+	ErrTableNotFound = errors.New("vector store table not found")
+	// ErrInvalidTableSchema is returned by VerifyTable when a column the
+	// store uses is missing or has an incompatible type.
+	ErrInvalidTableSchema = errors.New("invalid vector store table schema")
+	// ErrEmptyDeleteFilter is returned by DeleteByFilter for an empty filter,
+	// which would delete every document.
+	ErrEmptyDeleteFilter = errors.New("delete filter must not be empty")
+	// ErrEmbeddingDimensionMismatch is returned by AddDocuments and
+	// AddVectors when an embedding does not have the dimension of the
+	// embedding column.
+	ErrEmbeddingDimensionMismatch = errors.New("embedding dimension mismatch")
+	// ErrPoolExhausted is returned by searches when no pool connection frees
+	// up within the WithPoolAcquireTimeout duration.
+	ErrPoolExhausted = errors.New("connection pool exhausted")
+)
+
 var _ vectorstores.VectorStore = &VectorStore{}
 
-// NewVectorStore creates a new VectorStore with options.
+// NewVectorStore creates a new VectorStore with options. The embedder may be
+// nil for stores that are only used with precomputed embeddings through
+// AddVectors and SimilaritySearchByVector.
 func NewVectorStore(engine alloydbutil.PostgresEngine,
 	embedder embeddings.Embedder,
 	tableName string,
@@ -63,23 +176,243 @@ func NewVectorStore(engine alloydbutil.PostgresEngine,
 }
 
 // AddDocuments adds documents to the Postgres collection, and returns the ids
-// of the added documents.
-func (vs *VectorStore) AddDocuments(ctx context.Context, docs []schema.Document, _ ...vectorstores.Option) ([]string, error) {
+// of the added documents. The WithNameSpace option writes to another table in
+// the store's schema, WithEmbedder overrides the store's embedder and
+// WithDeduplicater skips documents before they are embedded. Other options are
+// ignored. A store created with WithDeduplicate also skips documents whose
+// content is already stored.
+//
+// The documents and their metadata are not modified, so the same documents
+// may be added concurrently. The documents are committed by the time
+// AddDocuments returns, so a search made afterwards finds them. pgvector
+// updates its indexes as rows are inserted, including indexes built with
+// ApplyVectorIndex concurrently, so no refresh is needed before searching.
+func (vs *VectorStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts := applyOpts(options...)
+	embedder := vs.embedder
+	if opts.Embedder != nil {
+		embedder = opts.Embedder
+	}
+	if embedder == nil {
+		return nil, ErrMissingEmbedder
+	}
+	if opts.Deduplicater != nil {
+		docs = slices.DeleteFunc(slices.Clone(docs), func(doc schema.Document) bool {
+			return opts.Deduplicater(ctx, doc)
+		})
+	}
+	if vs.deduplicate {
+		return vs.addDeduplicated(ctx, embedder, docs, options...)
+	}
+	return vs.embedAndAdd(ctx, embedder, docs, options...)
+}
+
+// embedAndAdd embeds the documents and adds them with AddVectors.
+func (vs *VectorStore) embedAndAdd(ctx context.Context, embedder embeddings.Embedder, docs []schema.Document,
+	options ...vectorstores.Option,
+) ([]string, error) {
 	texts := make([]string, 0, len(docs))
 	for _, doc := range docs {
 		texts = append(texts, doc.PageContent)
 	}
-	embeddings, err := vs.embedder.EmbedDocuments(ctx, texts)
+	embeddings, err := embedder.EmbedDocuments(ctx, texts)
 	if err != nil {
 		return nil, fmt.Errorf("failed embed documents: %w", err)
 	}
+	return vs.AddVectors(ctx, embeddings, docs, options...)
+}
+
+// addDeduplicated embeds and adds only the documents whose content is not
+// already stored in the target table or repeated earlier in docs. Skipped
+// documents get the id of the stored row or earlier document.
+func (vs *VectorStore) addDeduplicated(ctx context.Context, embedder embeddings.Embedder, docs []schema.Document,
+	options ...vectorstores.Option,
+) ([]string, error) {
+	target, err := vs.nameSpaceStore(applyOpts(options...))
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]string, len(docs))
+	for i, doc := range docs {
+		contents[i] = doc.PageContent
+	}
+	idsByContent, err := target.storedContentIDs(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+	var newDocs []schema.Document
+	for _, doc := range docs {
+		if _, ok := idsByContent[doc.PageContent]; ok {
+			continue
+		}
+		// Later copies of the document get its id once it is added.
+		idsByContent[doc.PageContent] = ""
+		newDocs = append(newDocs, doc)
+	}
+	if len(newDocs) > 0 {
+		newIDs, err := vs.embedAndAdd(ctx, embedder, newDocs, options...)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range newIDs {
+			idsByContent[newDocs[i].PageContent] = id
+		}
+	}
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = idsByContent[doc.PageContent]
+	}
+	return ids, nil
+}
+
+// storedContentQuery returns the statement selecting the content and id of
+// the rows whose content is one of the given contents. The contents are
+// compared as bytes so that the parameter takes the type of the content
+// column, whether text or bytea, and an index on the column can be used.
+func (vs *VectorStore) storedContentQuery(contents []string) (string, []any) {
+	values := make([][]byte, len(contents))
+	for i, content := range contents {
+		values[i] = []byte(content)
+	}
+	args := []any{values}
+	tenantCondition := ""
+	if vs.tenantColumn != "" {
+		args = append(args, vs.tenant)
+		tenantCondition = fmt.Sprintf(" AND %s = $2", vs.tenantColumn)
+	}
+	stmt := fmt.Sprintf(`SELECT %s, %s::text FROM "%s"."%s" WHERE %s = ANY($1)%s`,
+		vs.contentColumn, vs.idColumn, vs.schemaName, vs.tableName, vs.contentColumn, tenantCondition)
+	return stmt, args
+}
+
+// storedContentIDs returns the id of a stored row by content for the given
+// contents that are stored.
+func (vs *VectorStore) storedContentIDs(ctx context.Context, contents []string) (map[string]string, error) {
+	stmt, args := vs.storedContentQuery(contents)
+	rows, err := vs.engine.Pool.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up stored documents: %w", err)
+	}
+	defer rows.Close()
+	ids := map[string]string{}
+	for rows.Next() {
+		var content []byte
+		var id string
+		if err := rows.Scan(&content, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan stored document: %w", err)
+		}
+		ids[string(content)] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return ids, nil
+}
+
+// AddVectors adds documents with precomputed embeddings to the Postgres
+// collection, and returns the ids of the added documents. It does not need an
+// embedder. The WithNameSpace option writes to another table in the store's
+// schema; other options are ignored.
+func (vs *VectorStore) AddVectors(ctx context.Context, embeddings [][]float32, docs []schema.Document,
+	options ...vectorstores.Option,
+) ([]string, error) {
+	if len(embeddings) != len(docs) {
+		return nil, ErrEmbedderWrongNumberVectors
+	}
+	target, err := vs.nameSpaceStore(applyOpts(options...))
+	if err != nil {
+		return nil, err
+	}
+	if err := target.checkEmbeddingDimension(ctx, embeddings); err != nil {
+		return nil, err
+	}
+	vectors := make([]string, len(embeddings))
+	for i, embedding := range embeddings {
+		vectors[i] = pgvector.NewVector(embedding).String()
+	}
+	return vs.addVectorLiterals(ctx, vectors, docs, options...)
+}
+
+// checkEmbeddingDimension returns ErrEmbeddingDimensionMismatch when an
+// embedding does not have the dimension of the embedding column, rather than
+// leaving Postgres to reject the insert.
+func (vs *VectorStore) checkEmbeddingDimension(ctx context.Context, embeddings [][]float32) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	dimension, err := vs.columnEmbeddingDimension(ctx)
+	if err != nil {
+		return err
+	}
+	if dimension == 0 {
+		return nil
+	}
+	for _, embedding := range embeddings {
+		if len(embedding) != dimension {
+			return fmt.Errorf("%w: embedding dimension %d does not match column dimension %d",
+				ErrEmbeddingDimensionMismatch, len(embedding), dimension)
+		}
+	}
+	return nil
+}
+
+// columnEmbeddingDimension returns the configured embedding dimension, or
+// detects it from the type modifier of the embedding column. It returns zero
+// when the dimension is unknown, such as for a column declared without one.
+func (vs *VectorStore) columnEmbeddingDimension(ctx context.Context) (int, error) {
+	if vs.embeddingDimension > 0 || vs.columnDimension == nil {
+		return vs.embeddingDimension, nil
+	}
+	cache := vs.columnDimension
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if dimension, ok := cache.dimensions[vs.tableName]; ok {
+		return dimension, nil
+	}
+
+	query := `SELECT a.atttypmod
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND a.attname = $3 AND NOT a.attisdropped`
+	var typmod int
+	err := vs.engine.Pool.QueryRow(ctx, query, vs.schemaName, vs.tableName, vs.embeddingColumn).Scan(&typmod)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Leave a missing table or column to the insert to report.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect embedding column dimension: %w", err)
+	}
+	if cache.dimensions == nil {
+		cache.dimensions = make(map[string]int)
+	}
+	cache.dimensions[vs.tableName] = max(typmod, 0)
+	return cache.dimensions[vs.tableName], nil
+}
+
+// addVectorLiterals inserts documents with their vectors, given as pgvector
+// literals, into the store's embedding column.
+func (vs *VectorStore) addVectorLiterals(ctx context.Context, vectors []string, docs []schema.Document,
+	options ...vectorstores.Option,
+) ([]string, error) {
+	target, err := vs.nameSpaceStore(applyOpts(options...))
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		texts = append(texts, doc.PageContent)
+	}
 	// If no ids provided, generate them.
 	ids := make([]string, len(texts))
 	for i, doc := range docs {
 		if val, ok := doc.Metadata["id"].(string); ok {
 			ids[i] = val
-		} else {
-			ids[i] = uuid.New().String()
+			continue
+		}
+		if ids[i], err = vs.idGenerator(doc); err != nil {
+			return nil, fmt.Errorf("failed to generate document id: %w", err)
 		}
 	}
 	// If no metadata provided, initialize with empty maps
@@ -96,23 +429,48 @@ func (vs *VectorStore) AddDocuments(ctx context.Context, docs []schema.Document,
 	for i := range texts {
 		id := ids[i]
 		content := texts[i]
-		embedding := pgvector.NewVector(embeddings[i]).String()
+		embedding := vectors[i]
 		metadata := metadatas[i]
-		query, values, err := vs.generateAddDocumentsQuery(id, content, embedding, metadata)
+		query, values, err := target.generateAddDocumentsQuery(id, content, embedding, metadata)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate query: %w", err)
 		}
 		b.Queue(query, values...)
 	}
 
-	batchResults := vs.engine.Pool.SendBatch(ctx, b)
-	if err := batchResults.Close(); err != nil {
-		return nil, fmt.Errorf("failed to execute batch: %w", err)
+	if err := vs.sendAddDocumentsBatch(ctx, b); err != nil {
+		return nil, err
 	}
 
 	return ids, nil
 }
 
+// sendAddDocumentsBatch executes the insert batch, inside a transaction
+// unless the store was created with WithTransactional(false).
+func (vs *VectorStore) sendAddDocumentsBatch(ctx context.Context, b *pgx.Batch) error {
+	if !vs.transactional {
+		if err := vs.engine.Pool.SendBatch(ctx, b).Close(); err != nil {
+			return fmt.Errorf("failed to execute batch: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := vs.engine.Pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("failed to execute batch: %w (rollback failed: %w)", err, rbErr)
+		}
+		return fmt.Errorf("failed to execute batch: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (vs *VectorStore) generateAddDocumentsQuery(id, content, embedding string, metadata map[string]any) (string, []any, error) {
 	// Construct metadata column names if present
 	metadataColNames := ""
@@ -124,9 +482,17 @@ func (vs *VectorStore) generateAddDocumentsQuery(id, content, embedding string,
 		metadataColNames += ", " + vs.metadataJSONColumn
 	}
 
+	if vs.tenantColumn != "" {
+		metadataColNames += ", " + vs.tenantColumn
+	}
+
 	insertStmt := fmt.Sprintf(`INSERT INTO %q.%q (%s, %s, %s%s)`,
 		vs.schemaName, vs.tableName, vs.idColumn, vs.contentColumn, vs.embeddingColumn, metadataColNames)
-	valuesStmt := "VALUES ($1, $2, $3"
+	contentParam := "$2"
+	if vs.contentCast != "" {
+		contentParam += "::" + vs.contentCast
+	}
+	valuesStmt := fmt.Sprintf("VALUES ($1, %s, $3", contentParam)
 	values := []any{id, content, embedding}
 
 	// Add metadata
@@ -147,20 +513,158 @@ func (vs *VectorStore) generateAddDocumentsQuery(id, content, embedding string,
 		}
 		values = append(values, metadataJSON)
 	}
+	if vs.tenantColumn != "" {
+		valuesStmt += fmt.Sprintf(", $%d", len(values)+1)
+		values = append(values, vs.tenant)
+	}
 	valuesStmt += ")"
 	query := insertStmt + valuesStmt
 	return query, values, nil
 }
 
 // SimilaritySearch performs a similarity search on the database using the
-// query vector.
-func (vs *VectorStore) SimilaritySearch(ctx context.Context, query string, _ int, options ...vectorstores.Option) ([]schema.Document, error) {
+// query vector. It returns at most numDocuments documents, falling back to the
+// store's k when numDocuments is not positive. A score threshold is only
+// supported with the cosine distance strategy. Filters are either a raw SQL
+// condition or MetadataFilter values on keys of the metadata JSON column. The
+// WithTimeout option bounds the whole search, including embedding the query.
+func (vs *VectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int,
+	options ...vectorstores.Option,
+) ([]schema.Document, error) {
+	opts := applyOpts(options...)
+	ctx, cancel := withSearchTimeout(ctx, opts)
+	defer cancel()
+	embedding, err := vs.embedQuery(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return vs.SimilaritySearchByVector(ctx, embedding, numDocuments, options...)
+}
+
+// SimilaritySearchIter performs a similarity search like SimilaritySearch but
+// streams the documents from the database cursor instead of collecting them,
+// which keeps memory bounded for a large numDocuments. The query runs when
+// iteration starts, and its rows are closed when iteration ends, including
+// when the caller stops early. A query or scan error is yielded with an empty
+// document and ends the iteration. The WithTimeout option bounds the whole
+// search, from embedding the query in the call to the end of the iteration,
+// so the returned function is meant to be ranged over once. It is an
+// iter.Seq2[schema.Document, error] for ranging over with Go 1.23 or later.
+func (vs *VectorStore) SimilaritySearchIter(ctx context.Context, query string, numDocuments int,
+	options ...vectorstores.Option,
+) (func(yield func(schema.Document, error) bool), error) {
 	opts := applyOpts(options...)
-	var documents []schema.Document
-	embedding, err := vs.embedder.EmbedQuery(ctx, query)
+	ctx, cancel := withSearchTimeout(ctx, opts)
+	embedding, err := vs.embedQuery(ctx, query, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stmt, args, err := vs.similaritySearchQuery(pgvector.NewVector(embedding).String(), numDocuments, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return func(yield func(schema.Document, error) bool) {
+		defer cancel()
+		rows, release, err := vs.querySearch(ctx, stmt, args...)
+		if err != nil {
+			yield(schema.Document{}, err)
+			return
+		}
+		defer release()
+		defer rows.Close()
+		for rows.Next() {
+			result, err := vs.scanSearchDocument(rows)
+			var doc schema.Document
+			if err == nil {
+				doc, err = vs.resultToDocument(result)
+			}
+			if !yield(doc, err) || err != nil {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(schema.Document{}, fmt.Errorf("rows iteration error: %w", err))
+		}
+	}, nil
+}
+
+// withSearchTimeout returns ctx bounded by the WithTimeout option, if given.
+func withSearchTimeout(ctx context.Context, opts vectorstores.Options) (context.Context, context.CancelFunc) {
+	if opts.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, opts.Timeout)
+}
+
+// embedQuery embeds a search query with the WithEmbedder option's embedder,
+// falling back to the store's.
+func (vs *VectorStore) embedQuery(ctx context.Context, query string, opts vectorstores.Options) ([]float32, error) {
+	embedder := vs.embedder
+	if opts.Embedder != nil {
+		embedder = opts.Embedder
+	}
+	if embedder == nil {
+		return nil, ErrMissingEmbedder
+	}
+	embedding, err := embedder.EmbedQuery(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed embed query: %w", err)
 	}
+	return embedding, nil
+}
+
+// SimilaritySearchByVector performs a similarity search on the database using
+// a precomputed embedding. It behaves like SimilaritySearch but does not need
+// an embedder. The WithNameSpace option searches another table in the store's
+// schema.
+func (vs *VectorStore) SimilaritySearchByVector(ctx context.Context, embedding []float32, numDocuments int,
+	options ...vectorstores.Option,
+) ([]schema.Document, error) {
+	return vs.similaritySearchByLiteral(ctx, pgvector.NewVector(embedding).String(), numDocuments, options...)
+}
+
+// similaritySearchByLiteral searches the store's embedding column for the
+// vector given as a pgvector literal.
+func (vs *VectorStore) similaritySearchByLiteral(ctx context.Context, vector string, numDocuments int,
+	options ...vectorstores.Option,
+) ([]schema.Document, error) {
+	opts := applyOpts(options...)
+	stmt, args, err := vs.similaritySearchQuery(vector, numDocuments, opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withSearchTimeout(ctx, opts)
+	defer cancel()
+	results, err := vs.executeSQLQuery(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute sql query: %w", err)
+	}
+	documents, err := vs.processResultsToDocuments(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process Results to Documents with Scores: %w", err)
+	}
+	return documents, nil
+}
+
+// similaritySearchQuery builds the statement and arguments of a search for
+// the vector given as a pgvector literal.
+func (vs *VectorStore) similaritySearchQuery(vector string, numDocuments int, opts vectorstores.Options) (string, []any, error) {
+	if opts.ScoreThreshold < 0 || opts.ScoreThreshold > 1 {
+		return "", nil, ErrInvalidScoreThreshold
+	}
+	if _, ok := vs.distanceStrategy.(CosineDistance); opts.ScoreThreshold != 0 && !ok {
+		return "", nil, fmt.Errorf("%w: score threshold requires the cosine distance strategy", ErrUnsupportedOptions)
+	}
+	target, err := vs.nameSpaceStore(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	k := vs.k
+	if numDocuments > 0 {
+		k = numDocuments
+	}
 	operator := vs.distanceStrategy.operator()
 	searchFunction := vs.distanceStrategy.similaritySearchFunction()
 
@@ -168,42 +672,162 @@ func (vs *VectorStore) SimilaritySearch(ctx context.Context, query string, _ int
 	columns = append(columns, vs.contentColumn)
 	if vs.metadataJSONColumn != "" {
 		columns = append(columns, vs.metadataJSONColumn)
+	} else {
+		columns = append(columns, "'{}'")
 	}
 	columnNames := strings.Join(columns, `, `)
+	args := []any{k}
+	conditions := []string{}
+	condition, args, err := vs.filterCondition(opts.Filters, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if target.tenantColumn != "" {
+		args = append(args, target.tenant)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", target.tenantColumn, len(args)))
+	}
+	if opts.ScoreThreshold != 0 {
+		// Scores are cosine distances, so a similarity threshold t keeps
+		// documents whose distance is at most 1 - t.
+		conditions = append(conditions, fmt.Sprintf("%s(%s, '%s') <= %f",
+			searchFunction, vs.embeddingColumn, vector, 1-opts.ScoreThreshold))
+	}
 	whereClause := ""
-	if opts.Filters != nil {
-		whereClause = fmt.Sprintf("WHERE %s", opts.Filters)
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
 	}
-	vector := pgvector.NewVector(embedding)
 	stmt := fmt.Sprintf(`
-        SELECT %s, %s(%s, '%s') AS distance FROM "%s"."%s" %s ORDER BY %s %s '%s' LIMIT $1::int;`,
-		columnNames, searchFunction, vs.embeddingColumn, vector.String(), vs.schemaName, vs.tableName, whereClause, vs.embeddingColumn, operator, vector.String())
+        SELECT %s, %s %s '%s' AS distance%s FROM "%s"."%s" %s ORDER BY %s %s '%s' LIMIT $1::int;`,
+		columnNames, vs.embeddingColumn, operator, vector, vs.metadataColumnsSelect(), target.schemaName, target.tableName, whereClause, vs.embeddingColumn, operator, vector)
 
-	results, err := vs.executeSQLQuery(ctx, stmt)
+	return stmt, args, nil
+}
+
+// SimilaritySearchWithScore performs a similarity search like
+// SimilaritySearch and also returns the score of each document, aligned
+// index-for-index with the returned documents.
+func (vs *VectorStore) SimilaritySearchWithScore(ctx context.Context, query string, numDocuments int,
+	options ...vectorstores.Option,
+) ([]schema.Document, []float32, error) {
+	docs, err := vs.SimilaritySearch(ctx, query, numDocuments, options...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute sql query: %w", err)
+		return nil, nil, err
+	}
+	scores := make([]float32, len(docs))
+	for i, doc := range docs {
+		scores[i] = doc.Score
+	}
+	return docs, scores, nil
+}
+
+// newUUID is the default id generator.
+func newUUID(schema.Document) (string, error) {
+	return uuid.New().String(), nil
+}
+
+// AsRetriever returns a retriever that searches this store for numDocuments
+// documents, applying the given options to every search.
+func (vs *VectorStore) AsRetriever(numDocuments int, options ...vectorstores.Option) vectorstores.Retriever {
+	return vectorstores.ToRetriever(vs, numDocuments, options...)
+}
+
+// DeleteByFilter deletes the documents matching filter, a MetadataFilter, a
+// *MetadataFilter or a []MetadataFilter whose filters must all match, and
+// returns the number of deleted documents. The filter values are bound as
+// query arguments; raw SQL filters are rejected with ErrInvalidMetadataFilter
+// so that a condition such as "true" cannot delete every document. The
+// WithNameSpace option selects the table or tenant as in SimilaritySearch;
+// other options are ignored. An empty filter is rejected with
+// ErrEmptyDeleteFilter rather than deleting every document.
+func (vs *VectorStore) DeleteByFilter(ctx context.Context, filter any, options ...vectorstores.Option) (int64, error) {
+	target, err := vs.nameSpaceStore(applyOpts(options...))
+	if err != nil {
+		return 0, err
 	}
-	documents, err = vs.processResultsToDocuments(results)
+	metadataFilters, err := deleteMetadataFilters(filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process Results to Documents with Scores: %w", err)
+		return 0, err
 	}
-	return documents, nil
+	if len(metadataFilters) == 0 {
+		return 0, ErrEmptyDeleteFilter
+	}
+	condition, args, err := vs.filterCondition(metadataFilters, nil)
+	if err != nil {
+		return 0, err
+	}
+	conditions := []string{condition}
+	if target.tenantColumn != "" {
+		args = append(args, target.tenant)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", target.tenantColumn, len(args)))
+	}
+	stmt := fmt.Sprintf(`DELETE FROM %q.%q WHERE %s`,
+		target.schemaName, target.tableName, strings.Join(conditions, " AND "))
+	tag, err := vs.engine.Pool.Exec(ctx, stmt, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete documents: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// deleteMetadataFilters returns the metadata filters of a DeleteByFilter
+// filter, rejecting raw SQL and other filter types.
+func deleteMetadataFilters(filter any) ([]MetadataFilter, error) {
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case MetadataFilter:
+		return []MetadataFilter{f}, nil
+	case *MetadataFilter:
+		if f == nil {
+			return nil, nil
+		}
+		return []MetadataFilter{*f}, nil
+	case []MetadataFilter:
+		return f, nil
+	default:
+		return nil, fmt.Errorf("%w: DeleteByFilter does not support filter type %T", ErrInvalidMetadataFilter, filter)
+	}
+}
+
+// nameSpaceStore returns the store a call with the given options works on.
+// With a tenant column the namespace names the tenant and is required;
+// otherwise it selects another table in the store's schema.
+func (vs *VectorStore) nameSpaceStore(opts vectorstores.Options) (*VectorStore, error) {
+	if vs.tenantColumn != "" {
+		if opts.NameSpace == "" {
+			return nil, ErrMissingTenant
+		}
+		tenantStore := *vs
+		tenantStore.tenant = opts.NameSpace
+		return &tenantStore, nil
+	}
+	if opts.NameSpace == "" {
+		return vs, nil
+	}
+	if err := sqlutil.ValidateSimpleIdentifier(opts.NameSpace); err != nil {
+		return nil, fmt.Errorf("invalid namespace: %w", err)
+	}
+	nsStore := *vs
+	nsStore.tableName = opts.NameSpace
+	return &nsStore, nil
 }
 
-func (vs *VectorStore) executeSQLQuery(ctx context.Context, stmt string) ([]SearchDocument, error) {
-	rows, err := vs.engine.Pool.Query(ctx, stmt, vs.k)
+func (vs *VectorStore) executeSQLQuery(ctx context.Context, stmt string, args ...any) ([]SearchDocument, error) {
+	rows, release, err := vs.querySearch(ctx, stmt, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute similar search query: %w", err)
+		return nil, err
 	}
+	defer release()
 	defer rows.Close()
 
 	var results []SearchDocument
 	for rows.Next() {
-		doc := SearchDocument{}
-
-		err = rows.Scan(&doc.Content, &doc.LangchainMetadata, &doc.Distance)
+		doc, err := vs.scanSearchDocument(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan result: %w", err)
+			return nil, err
 		}
 		results = append(results, doc)
 	}
@@ -213,76 +837,435 @@ func (vs *VectorStore) executeSQLQuery(ctx context.Context, stmt string) ([]Sear
 	return results, nil
 }
 
-func (*VectorStore) processResultsToDocuments(results []SearchDocument) ([]schema.Document, error) {
+// querySearch runs a search statement, on a checked connection when the
+// store was created with WithConnCheckOnSearch, on a connection acquired
+// within the WithPoolAcquireTimeout duration, and in a transaction setting
+// the index parameters of WithEFSearch and WithProbes. The returned release
+// function must be called once the rows are closed.
+func (vs *VectorStore) querySearch(ctx context.Context, stmt string, args ...any) (pgx.Rows, func(), error) {
+	var querier searchQuerier
+	release := func() {}
+	if vs.connCheckOnSearch {
+		conn, err := vs.healthyConn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		querier, release = conn, conn.Release
+	} else if vs.poolAcquireTimeout > 0 {
+		conn, err := vs.acquire(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		querier, release = conn, conn.Release
+	} else {
+		querier = vs.engine.Pool
+	}
+	if settings := vs.searchSettings(); len(settings) > 0 {
+		tx, err := beginSearchTx(ctx, querier, settings)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		releaseConn := release
+		querier, release = tx, func() {
+			// The search only reads, so the transaction is rolled back.
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			releaseConn()
+		}
+	}
+	rows, err := querier.Query(ctx, stmt, args...)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to execute similar search query: %w", err)
+	}
+	return rows, release, nil
+}
+
+// searchSettings returns the SET LOCAL statements of the index parameters
+// configured for searches.
+func (vs *VectorStore) searchSettings() []string {
+	var settings []string
+	if vs.efSearch > 0 {
+		settings = append(settings, fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", vs.efSearch))
+	}
+	if vs.probes > 0 {
+		settings = append(settings, fmt.Sprintf("SET LOCAL ivfflat.probes = %d", vs.probes))
+	}
+	return settings
+}
+
+// beginSearchTx begins a transaction on querier and runs the given settings
+// statements in it.
+func beginSearchTx(ctx context.Context, querier searchQuerier, settings []string) (pgx.Tx, error) {
+	tx, err := querier.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin search transaction: %w", err)
+	}
+	for _, setting := range settings {
+		if _, err := tx.Exec(ctx, setting); err != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			return nil, fmt.Errorf("failed to apply search setting %q: %w", setting, err)
+		}
+	}
+	return tx, nil
+}
+
+// scanSearchDocument scans the current row of a search.
+func (vs *VectorStore) scanSearchDocument(rows pgx.Rows) (SearchDocument, error) {
+	doc := SearchDocument{}
+	var content any
+	columnValues := make([]any, len(vs.metadataColumns))
+	dest := []any{&content, &doc.LangchainMetadata, &doc.Distance}
+	for i := range columnValues {
+		dest = append(dest, &columnValues[i])
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return SearchDocument{}, fmt.Errorf("failed to scan result: %w", err)
+	}
+	var err error
+	if doc.Content, err = contentText(content); err != nil {
+		return SearchDocument{}, err
+	}
+	doc.MetadataColumns = vs.metadataColumnValues(columnValues)
+	return doc, nil
+}
+
+// healthyConn acquires a connection and pings it before use. A connection
+// that fails the ping is released, which makes the pool discard it, and the
+// acquisition is retried once.
+func (vs *VectorStore) healthyConn(ctx context.Context) (searchConn, error) {
+	var pingErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		conn, err := vs.acquire(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		if pingErr = conn.Ping(ctx); pingErr == nil {
+			return conn, nil
+		}
+		conn.Release()
+	}
+	return nil, fmt.Errorf("failed to get a healthy connection: %w", pingErr)
+}
+
+// acquire acquires a connection for a search. With a pool acquire timeout,
+// it fails with ErrPoolExhausted when no connection frees up in time, unless
+// ctx itself is done first.
+func (vs *VectorStore) acquire(ctx context.Context) (searchConn, error) {
+	acquire := vs.acquireConn
+	if acquire == nil {
+		acquire = func(ctx context.Context) (searchConn, error) {
+			return vs.engine.Pool.Acquire(ctx)
+		}
+	}
+	if vs.poolAcquireTimeout <= 0 {
+		return acquire(ctx)
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, vs.poolAcquireTimeout)
+	defer cancel()
+	conn, err := acquire(acquireCtx)
+	if err != nil && ctx.Err() == nil && acquireCtx.Err() != nil {
+		return nil, fmt.Errorf("%w: no connection available within %s", ErrPoolExhausted, vs.poolAcquireTimeout)
+	}
+	return conn, err
+}
+
+// metadataColumnsSelect returns the store's metadata columns as a list to
+// append to a SELECT clause.
+func (vs *VectorStore) metadataColumnsSelect() string {
+	if len(vs.metadataColumns) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(vs.metadataColumns, ", ")
+}
+
+// metadataColumnValues maps scanned metadata column values to their column
+// names, leaving out NULL values. It returns nil when the store has no
+// metadata columns.
+func (vs *VectorStore) metadataColumnValues(values []any) map[string]any {
+	if len(values) == 0 {
+		return nil
+	}
+	columns := make(map[string]any, len(values))
+	for i, value := range values {
+		if value != nil {
+			columns[vs.metadataColumns[i]] = value
+		}
+	}
+	return columns
+}
+
+// contentText converts a scanned content column value to text. Text columns
+// scan as strings, bytea columns as bytes holding UTF-8 text and NULL as nil.
+func contentText(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		if !utf8.Valid(v) {
+			return "", errors.New("content column value is not valid UTF-8")
+		}
+		return string(v), nil
+	case *string:
+		if v == nil {
+			return "", nil
+		}
+		return *v, nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported content column type %T", value)
+	}
+}
+
+func (vs *VectorStore) processResultsToDocuments(results []SearchDocument) ([]schema.Document, error) {
 	documents := make([]schema.Document, 0, len(results))
 	for _, result := range results {
-		mapMetadata := map[string]any{}
-		err := json.Unmarshal([]byte(result.LangchainMetadata), &mapMetadata)
+		doc, err := vs.resultToDocument(result)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal langchain metadata: %w", err)
-		}
-		doc := schema.Document{
-			PageContent: result.Content,
-			Metadata:    mapMetadata,
-			Score:       result.Distance,
+			return nil, err
 		}
 		documents = append(documents, doc)
 	}
 	return documents, nil
 }
 
+// resultToDocument converts a search result to a document scored by the
+// store's distance strategy.
+func (vs *VectorStore) resultToDocument(result SearchDocument) (schema.Document, error) {
+	mapMetadata, err := resultMetadata(result)
+	if err != nil {
+		return schema.Document{}, err
+	}
+	mapMetadata[DistanceMetadataKey] = result.Distance
+	return schema.Document{
+		PageContent: result.Content,
+		Metadata:    mapMetadata,
+		Score:       vs.distanceStrategy.similarity(result.Distance),
+	}, nil
+}
+
+// resultMetadata returns the metadata of a result, merging its metadata JSON
+// and metadata column values.
+func resultMetadata(result SearchDocument) (map[string]any, error) {
+	mapMetadata := map[string]any{}
+	err := json.Unmarshal([]byte(result.LangchainMetadata), &mapMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal langchain metadata: %w", err)
+	}
+	if mapMetadata == nil {
+		mapMetadata = map[string]any{}
+	}
+	// Metadata columns hold the authoritative values for their keys.
+	for column, value := range result.MetadataColumns {
+		mapMetadata[column] = value
+	}
+	return mapMetadata, nil
+}
+
+// GroupedSimilaritySearch performs a similarity search and returns, for each
+// distinct value of groupBy, at most kPerGroup documents ordered by distance.
+// groupBy is either one of the configured metadata columns or a key of the
+// metadata JSON column. Documents with a NULL group value are returned under
+// the empty key. It takes the same per-call options as SimilaritySearch, and
+// runs like it with the store's search settings.
+func (vs *VectorStore) GroupedSimilaritySearch(ctx context.Context, query string, groupBy string,
+	kPerGroup int, options ...vectorstores.Option,
+) (map[string][]schema.Document, error) {
+	if groupBy == "" {
+		return nil, errors.New("missing group by key")
+	}
+	if kPerGroup <= 0 {
+		return nil, errors.New("kPerGroup must be greater than zero")
+	}
+	opts := applyOpts(options...)
+	ctx, cancel := withSearchTimeout(ctx, opts)
+	defer cancel()
+	embedding, err := vs.embedQuery(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := vs.nameSpaceStore(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{kPerGroup}
+	groupExpr := ""
+	if slices.Contains(vs.metadataColumns, groupBy) {
+		groupExpr = groupBy
+	} else {
+		if vs.metadataJSONColumn == "" {
+			return nil, fmt.Errorf("group by key %q is not a metadata column", groupBy)
+		}
+		args = append(args, groupBy)
+		groupExpr = fmt.Sprintf("%s->>$%d", vs.metadataJSONColumn, len(args))
+	}
+	metadataExpr := "'{}'"
+	if vs.metadataJSONColumn != "" {
+		metadataExpr = fmt.Sprintf("COALESCE(%s::text, '{}')", vs.metadataJSONColumn)
+	}
+	conditions := []string{}
+	condition, args, err := vs.filterCondition(opts.Filters, args)
+	if err != nil {
+		return nil, err
+	}
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if target.tenantColumn != "" {
+		args = append(args, target.tenant)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", target.tenantColumn, len(args)))
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	vector := pgvector.NewVector(embedding).String()
+	stmt := fmt.Sprintf(`
+        SELECT content, metadata, distance, group_key%s FROM (
+            SELECT %s AS content, %s AS metadata, %s %s '%s' AS distance,
+                COALESCE((%s)::text, '') AS group_key,
+                ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s %s '%s') AS group_rank%s
+            FROM "%s"."%s" %s
+        ) AS ranked WHERE group_rank <= $1::int ORDER BY group_key, group_rank;`,
+		vs.metadataColumnsSelect(),
+		vs.contentColumn, metadataExpr, vs.embeddingColumn, vs.distanceStrategy.operator(), vector,
+		groupExpr, groupExpr, vs.embeddingColumn, vs.distanceStrategy.operator(), vector, vs.metadataColumnsSelect(),
+		target.schemaName, target.tableName, whereClause)
+
+	rows, release, err := vs.querySearch(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer rows.Close()
+
+	groups := make(map[string][]schema.Document)
+	for rows.Next() {
+		var result SearchDocument
+		var content any
+		var groupKey string
+		columnValues := make([]any, len(vs.metadataColumns))
+		dest := []any{&content, &result.LangchainMetadata, &result.Distance, &groupKey}
+		for i := range columnValues {
+			dest = append(dest, &columnValues[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan result: %w", err)
+		}
+		if result.Content, err = contentText(content); err != nil {
+			return nil, err
+		}
+		result.MetadataColumns = vs.metadataColumnValues(columnValues)
+		docs, err := vs.processResultsToDocuments([]SearchDocument{result})
+		if err != nil {
+			return nil, fmt.Errorf("failed to process results to documents: %w", err)
+		}
+		groups[groupKey] = append(groups[groupKey], docs...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return groups, nil
+}
+
 // ApplyVectorIndex creates an index in the table of the embeddings.
 func (vs *VectorStore) ApplyVectorIndex(ctx context.Context, index BaseIndex, name string, concurrently bool) error {
 	if index.indexType == "exactnearestneighbor" {
 		return vs.DropVectorIndex(ctx, name)
 	}
-	function := index.distanceStrategy.searchFunction()
+	stmt, err := vs.createIndexStatement(index, name, concurrently)
+	if err != nil {
+		return err
+	}
 	if index.indexType == "ScaNN" {
 		_, err := vs.engine.Pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS alloydb_scann")
 		if err != nil {
 			return fmt.Errorf("failed to create alloydb scann extension: %w", err)
 		}
 	}
+
+	_, err = vs.engine.Pool.Exec(ctx, stmt)
+	if err != nil {
+		return fmt.Errorf("failed to execute creation of index: %w", err)
+	}
+
+	return nil
+}
+
+// createIndexStatement builds the CREATE INDEX statement for the given index.
+// Partial index predicates are parenthesized and combined with AND, so that a
+// predicate using OR keeps its meaning.
+func (vs *VectorStore) createIndexStatement(index BaseIndex, name string, concurrently bool) (string, error) {
 	filter := ""
 	if len(index.partialIndexes) > 0 {
-		filter = fmt.Sprintf("WHERE %s", index.partialIndexes)
+		predicates := make([]string, len(index.partialIndexes))
+		for i, predicate := range index.partialIndexes {
+			if strings.TrimSpace(predicate) == "" {
+				return "", errors.New("partial index predicates must not be empty")
+			}
+			predicates[i] = "(" + predicate + ")"
+		}
+		filter = fmt.Sprintf("WHERE %s", strings.Join(predicates, " AND "))
 	}
 	optsString := index.indexOptions()
 	params := fmt.Sprintf("WITH %s", optsString)
 
 	if name == "" {
 		if index.name == "" {
-			index.name = vs.tableName + defaultIndexNameSuffix
+			index.name = vs.defaultIndexName()
 		}
 		name = index.name
 	}
+	if err := vs.validateIndexIdentifiers(name); err != nil {
+		return "", err
+	}
 
 	concurrentlyStr := ""
 	if concurrently {
 		concurrentlyStr = "CONCURRENTLY"
 	}
 
+	function := index.distanceStrategy.searchFunction()
 	stmt := fmt.Sprintf(`CREATE INDEX %s %s ON "%s"."%s" USING %s (%s %s) %s %s`,
 		concurrentlyStr, name, vs.schemaName, vs.tableName, index.indexType, vs.embeddingColumn, function, params, filter)
-
-	_, err := vs.engine.Pool.Exec(ctx, stmt)
-	if err != nil {
-		return fmt.Errorf("failed to execute creation of index: %w", err)
-	}
-
-	return nil
+	return stmt, nil
 }
 
 // ReIndex recreates the index on the VectorStore.
 func (vs *VectorStore) ReIndex(ctx context.Context) error {
-	indexName := vs.tableName + defaultIndexNameSuffix
+	indexName := vs.defaultIndexName()
 	return vs.ReIndexWithName(ctx, indexName)
 }
 
-// ReIndex recreates the index on the VectorStore by name.
+// defaultIndexName returns the name of the index created when none is given.
+// Long names are cut to maxIndexNameLength bytes, as Postgres would cut them,
+// so the name still matches indexes created before it was shortened here.
+func (vs *VectorStore) defaultIndexName() string {
+	name := vs.tableName + defaultIndexNameSuffix
+	if len(name) > maxIndexNameLength {
+		name = name[:maxIndexNameLength]
+	}
+	return name
+}
+
+// ReIndexWithName recreates the index on the VectorStore by name. It returns
+// ErrIndexNotFound if the table has no index with that name.
 func (vs *VectorStore) ReIndexWithName(ctx context.Context, indexName string) error {
+	if err := vs.validateIndexIdentifiers(indexName); err != nil {
+		return err
+	}
+	exists, err := vs.IsValidIndex(ctx, indexName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrIndexNotFound, indexName)
+	}
 	query := fmt.Sprintf("REINDEX INDEX %s;", indexName)
-	_, err := vs.engine.Pool.Exec(ctx, query)
+	_, err = vs.engine.Pool.Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to reindex: %w", err)
 	}
@@ -293,7 +1276,10 @@ func (vs *VectorStore) ReIndexWithName(ctx context.Context, indexName string) er
 // DropVectorIndex drops the vector index from the VectorStore.
 func (vs *VectorStore) DropVectorIndex(ctx context.Context, indexName string) error {
 	if indexName == "" {
-		indexName = vs.tableName + defaultIndexNameSuffix
+		indexName = vs.defaultIndexName()
+	}
+	if err := vs.validateIndexIdentifiers(indexName); err != nil {
+		return err
 	}
 	query := fmt.Sprintf("DROP INDEX IF EXISTS %s;", indexName)
 	_, err := vs.engine.Pool.Exec(ctx, query)
@@ -304,15 +1290,25 @@ func (vs *VectorStore) DropVectorIndex(ctx context.Context, indexName string) er
 	return nil
 }
 
-// IsValidIndex checks if index exists in the VectorStore.
+// IsValidIndex checks if index exists in the VectorStore. A missing index is
+// reported as false with a nil error; the error is reserved for failures to
+// run the check.
 func (vs *VectorStore) IsValidIndex(ctx context.Context, indexName string) (bool, error) {
 	if indexName == "" {
-		indexName = vs.tableName + defaultIndexNameSuffix
+		indexName = vs.defaultIndexName()
+	}
+	if err := vs.validateIndexIdentifiers(indexName); err != nil {
+		return false, err
 	}
-	query := fmt.Sprintf("SELECT tablename, indexname  FROM pg_indexes WHERE tablename = '%s' AND schemaname = '%s' AND indexname = '%s';",
-		vs.tableName, vs.schemaName, indexName)
+	// Index names are not quoted in the index statements, so Postgres
+	// stores them folded to lower case.
+	indexName = strings.ToLower(indexName)
+	query := "SELECT tablename, indexname FROM pg_indexes WHERE tablename = $1 AND schemaname = $2 AND indexname = $3;"
 	var tablename, indexnameFromDB string
-	err := vs.engine.Pool.QueryRow(ctx, query).Scan(&tablename, &indexnameFromDB)
+	err := vs.engine.Pool.QueryRow(ctx, query, vs.tableName, vs.schemaName, indexName).Scan(&tablename, &indexnameFromDB)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
 	if err != nil {
 		return false, fmt.Errorf("failed to check if index exists: %w", err)
 	}
@@ -320,6 +1316,120 @@ func (vs *VectorStore) IsValidIndex(ctx context.Context, indexName string) (bool
 	return indexnameFromDB == indexName, nil
 }
 
+// ValidateIndexStrategy checks that the indexes on the embedding column were
+// built with the operator class of the store's distance strategy. Searches
+// cannot use an index built for another strategy and fall back to a
+// sequential scan. It returns ErrIndexStrategyMismatch naming the first
+// mismatched index, and nil when the column has no index.
+func (vs *VectorStore) ValidateIndexStrategy(ctx context.Context) error {
+	query := `SELECT i.relname, opc.opcname
+		FROM pg_index x
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = x.indkey[0]
+		JOIN pg_opclass opc ON opc.oid = x.indclass[0]
+		WHERE n.nspname = $1 AND t.relname = $2 AND a.attname = $3
+		ORDER BY i.relname`
+	rows, err := vs.engine.Pool.Query(ctx, query, vs.schemaName, vs.tableName, vs.embeddingColumn)
+	if err != nil {
+		return fmt.Errorf("failed to fetch index operator classes: %w", err)
+	}
+	defer rows.Close()
+
+	expected := vs.distanceStrategy.searchFunction()
+	for rows.Next() {
+		var indexName, opClass string
+		if err := rows.Scan(&indexName, &opClass); err != nil {
+			return fmt.Errorf("failed to scan index operator class: %w", err)
+		}
+		if opClass != expected {
+			return fmt.Errorf("%w: index %s uses %s, distance strategy %s needs %s",
+				ErrIndexStrategyMismatch, indexName, opClass, vs.distanceStrategy, expected)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch index operator classes: %w", err)
+	}
+	return nil
+}
+
+// contentColumnTypes are the column data types the content column may have.
+var contentColumnTypes = []string{"text", "character varying", "character", "bytea"}
+
+// VerifyTable checks that the store's table exists with the id, content,
+// embedding and metadata JSON columns the store is configured with, so that
+// a misconfigured store fails with a descriptive error before its first
+// query. It returns ErrTableNotFound or ErrInvalidTableSchema.
+func (vs *VectorStore) VerifyTable(ctx context.Context) error {
+	query := `SELECT column_name, data_type, udt_name
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2`
+	rows, err := vs.engine.Pool.Query(ctx, query, vs.schemaName, vs.tableName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch table columns: %w", err)
+	}
+	defer rows.Close()
+
+	// Column types are keyed by name, using the user-defined type name for
+	// extension types such as vector.
+	columnTypes := map[string]string{}
+	for rows.Next() {
+		var name, dataType, udtName string
+		if err := rows.Scan(&name, &dataType, &udtName); err != nil {
+			return fmt.Errorf("failed to scan table column: %w", err)
+		}
+		if dataType == "USER-DEFINED" {
+			dataType = udtName
+		}
+		columnTypes[name] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to fetch table columns: %w", err)
+	}
+	if len(columnTypes) == 0 {
+		return fmt.Errorf("%w: %s.%s", ErrTableNotFound, vs.schemaName, vs.tableName)
+	}
+
+	// A nil allowed list accepts any column type.
+	type columnCheck struct {
+		column  string
+		role    string
+		allowed []string
+	}
+	checks := []columnCheck{
+		{column: vs.idColumn, role: "id"},
+		{column: vs.contentColumn, role: "content", allowed: contentColumnTypes},
+		{column: vs.embeddingColumn, role: "embedding", allowed: []string{"vector"}},
+	}
+	if vs.metadataJSONColumn != "" {
+		checks = append(checks, columnCheck{column: vs.metadataJSONColumn, role: "metadata JSON", allowed: []string{"json", "jsonb"}})
+	}
+	for _, check := range checks {
+		dataType, ok := columnTypes[check.column]
+		if !ok {
+			return fmt.Errorf("%w: %s column %q not found in %s.%s",
+				ErrInvalidTableSchema, check.role, check.column, vs.schemaName, vs.tableName)
+		}
+		if check.allowed != nil && !slices.Contains(check.allowed, dataType) {
+			return fmt.Errorf("%w: %s column %q has type %s, want one of %s",
+				ErrInvalidTableSchema, check.role, check.column, dataType, strings.Join(check.allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// validateIndexIdentifiers checks the index, table and schema names that are
+// interpolated into index statements.
+func (vs *VectorStore) validateIndexIdentifiers(indexName string) error {
+	for _, ident := range []string{indexName, vs.tableName, vs.schemaName} {
+		if err := sqlutil.ValidateSimpleIdentifier(ident); err != nil {
+			return fmt.Errorf("invalid index identifier: %w", err)
+		}
+	}
+	return nil
+}
+
 func (*VectorStore) NewBaseIndex(indexName, indexType string, strategy distanceStrategy, partialIndexes []string, opts Index) BaseIndex {
 	return BaseIndex{
 		name:             indexName,
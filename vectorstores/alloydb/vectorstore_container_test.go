@@ -2,9 +2,12 @@ package alloydb_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,8 +15,10 @@ import (
 	"github.com/averikitsch/langchaingo/llms/openai"
 	"github.com/averikitsch/langchaingo/schema"
 	"github.com/averikitsch/langchaingo/util/alloydbutil"
+	"github.com/averikitsch/langchaingo/vectorstores"
 	"github.com/averikitsch/langchaingo/vectorstores/alloydb"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -23,10 +28,6 @@ import (
 func preCheckEnvSetting(t *testing.T) string {
 	t.Helper()
 
-	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey == "" {
-		t.Skip("OPENAI_API_KEY not set")
-	}
-
 	pgvectorURL := os.Getenv("PGVECTOR_CONNECTION_STRING")
 	if pgvectorURL == "" {
 		pgVectorContainer, err := tcpostgres.RunContainer(
@@ -78,6 +79,9 @@ func setEngineWithImage(t *testing.T) alloydbutil.PostgresEngine {
 
 func initVectorStore(t *testing.T) (alloydb.VectorStore, func() error) {
 	t.Helper()
+	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey == "" {
+		t.Skip("OPENAI_API_KEY not set")
+	}
 	pgEngine := setEngineWithImage(t)
 	ctx := context.Background()
 	vectorstoreTableoptions := alloydbutil.VectorstoreTableOptions{
@@ -113,6 +117,57 @@ func initVectorStore(t *testing.T) (alloydb.VectorStore, func() error) {
 	return vs, cleanUpTableFn
 }
 
+const testVectorSize = 3
+
+// fakeEmbedder returns deterministic embeddings so container tests don't
+// depend on an external embedding provider.
+type fakeEmbedder struct{}
+
+func (e fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		v, err := e.EmbedQuery(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	v := make([]float32, testVectorSize)
+	for i, r := range text {
+		v[i%testVectorSize] += float32(r)
+	}
+	return v, nil
+}
+
+// initFakeVectorStore creates a table with the given options and a
+// VectorStore over it using fakeEmbedder.
+func initFakeVectorStore(t *testing.T, tableOptions alloydbutil.VectorstoreTableOptions,
+	opts ...alloydb.VectorStoreOption,
+) (alloydbutil.PostgresEngine, alloydb.VectorStore) {
+	t.Helper()
+	pgEngine := setEngineWithImage(t)
+	ctx := context.Background()
+	if tableOptions.TableName == "" {
+		tableOptions.TableName = "my_fake_test_table"
+	}
+	tableOptions.VectorSize = testVectorSize
+	tableOptions.OverwriteExisting = true
+	err := pgEngine.InitVectorstoreTable(ctx, tableOptions)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := pgEngine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableOptions.TableName))
+		require.NoError(t, err)
+	})
+
+	vs, err := alloydb.NewVectorStore(pgEngine, fakeEmbedder{}, tableOptions.TableName, opts...)
+	require.NoError(t, err)
+	return pgEngine, vs
+}
+
 func TestContainerPingToDB(t *testing.T) {
 	t.Parallel()
 	engine := setEngineWithImage(t)
@@ -236,3 +291,1213 @@ func TestContainerAddDocuments(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestContainerApplyVectorIndexOptions(t *testing.T) {
+	t.Parallel()
+	vs, cleanUpTableFn := initVectorStore(t)
+	t.Cleanup(func() {
+		if err := cleanUpTableFn(); err != nil {
+			t.Fatal("Cleanup failed:", err)
+		}
+	})
+	ctx := context.Background()
+
+	tcs := []struct {
+		name    string
+		index   string
+		options alloydb.Index
+	}{
+		{name: "hnswindex", index: "hnsw", options: alloydb.HNSWOptions{M: 4, EfConstruction: 16}},
+		{name: "ivfflatindex", index: "ivfflat", options: alloydb.IVFFlatOptions{Lists: 1}},
+	}
+	for _, tc := range tcs {
+		idx := vs.NewBaseIndex(tc.name, tc.index, alloydb.CosineDistance{}, []string{}, tc.options)
+		require.NoError(t, vs.ApplyVectorIndex(ctx, idx, tc.name, false))
+
+		isValid, err := vs.IsValidIndex(ctx, tc.name)
+		require.NoError(t, err)
+		require.True(t, isValid)
+
+		require.NoError(t, vs.DropVectorIndex(ctx, tc.name))
+	}
+}
+
+func TestContainerGroupedSimilaritySearch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:       "grouped_search_table",
+		StoreMetadata:   true,
+		MetadataColumns: []alloydbutil.Column{{Name: "category", DataType: "text", Nullable: true}},
+	}, alloydb.WithMetadataColumns([]string{"category"}))
+
+	_, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"category": "asia", "continent": "asia"}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"category": "asia", "continent": "asia"}},
+		{PageContent: "Osaka", Metadata: map[string]any{"category": "asia", "continent": "asia"}},
+		{PageContent: "Paris", Metadata: map[string]any{"category": "europe", "continent": "europe"}},
+		{PageContent: "London", Metadata: map[string]any{"category": "europe", "continent": "europe"}},
+		{PageContent: "Lima", Metadata: map[string]any{"category": "america", "continent": "america"}},
+	})
+	require.NoError(t, err)
+
+	for _, groupBy := range []string{"category", "continent"} {
+		groups, err := vs.GroupedSimilaritySearch(ctx, "Tokyo", groupBy, 2)
+		require.NoError(t, err)
+		require.Len(t, groups, 3)
+		require.Len(t, groups["asia"], 2)
+		require.Len(t, groups["europe"], 2)
+		require.Len(t, groups["america"], 1)
+		require.Equal(t, "Tokyo", groups["asia"][0].PageContent)
+		for _, docs := range groups {
+			for i := 1; i < len(docs); i++ {
+				require.GreaterOrEqual(t, docs[i-1].Score, docs[i].Score)
+			}
+		}
+	}
+}
+
+func TestContainerAsRetriever(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:       "retriever_table",
+		StoreMetadata:   true,
+		MetadataColumns: []alloydbutil.Column{{Name: "category", DataType: "text", Nullable: true}},
+	}, alloydb.WithMetadataColumns([]string{"category"}))
+
+	_, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"category": "asia"}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"category": "asia"}},
+		{PageContent: "Paris", Metadata: map[string]any{"category": "europe"}},
+		{PageContent: "London", Metadata: map[string]any{"category": "europe"}},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.AsRetriever(2).GetRelevantDocuments(ctx, "Tokyo")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+
+	docs, err = vs.AsRetriever(4, vectorstores.WithFilters("category = 'europe'")).
+		GetRelevantDocuments(ctx, "Tokyo")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, doc := range docs {
+		require.Contains(t, []string{"Paris", "London"}, doc.PageContent)
+	}
+}
+
+func TestContainerInitVectorstoreTableEffectiveColumns(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pgEngine := setEngineWithImage(t)
+
+	for _, storeMetadata := range []bool{true, false} {
+		tableName := fmt.Sprintf("effective_columns_%t", storeMetadata)
+		options := alloydbutil.VectorstoreTableOptions{
+			TableName:          tableName,
+			VectorSize:         testVectorSize,
+			ContentColumnName:  "body",
+			MetadataJSONColumn: "extra",
+			OverwriteExisting:  true,
+			StoreMetadata:      storeMetadata,
+		}
+		require.NoError(t, pgEngine.InitVectorstoreTable(ctx, options))
+		tableOptions, err := alloydbutil.EffectiveVectorstoreTableOptions(options)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := pgEngine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+			require.NoError(t, err)
+		})
+
+		rows, err := pgEngine.Pool.Query(ctx,
+			`SELECT column_name FROM information_schema.columns WHERE table_name = $1`, tableName)
+		require.NoError(t, err)
+		var columns []string
+		for rows.Next() {
+			var column string
+			require.NoError(t, rows.Scan(&column))
+			columns = append(columns, column)
+		}
+		require.NoError(t, rows.Err())
+		require.Contains(t, columns, tableOptions.ContentColumnName)
+		require.Contains(t, columns, tableOptions.EmbeddingColumn)
+		require.Contains(t, columns, tableOptions.IDColumn.Name)
+		if storeMetadata {
+			require.Equal(t, "extra", tableOptions.MetadataJSONColumn)
+			require.Contains(t, columns, tableOptions.MetadataJSONColumn)
+		} else {
+			require.Empty(t, tableOptions.MetadataJSONColumn)
+			require.NotContains(t, columns, "extra")
+		}
+
+		vs, err := alloydb.NewVectorStore(pgEngine, fakeEmbedder{}, tableOptions.TableName,
+			alloydb.WithContentColumn(tableOptions.ContentColumnName),
+			alloydb.WithEmbeddingColumn(tableOptions.EmbeddingColumn),
+			alloydb.WithIDColumn(tableOptions.IDColumn.Name),
+			alloydb.WithMetadataJSONColumn(tableOptions.MetadataJSONColumn),
+		)
+		require.NoError(t, err)
+		_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo", Metadata: map[string]any{}}})
+		require.NoError(t, err)
+		docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, "Tokyo", docs[0].PageContent)
+	}
+}
+
+func TestContainerPrecomputedVectorsWithoutEmbedder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pgEngine, _ := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:     "precomputed_table",
+		StoreMetadata: true,
+	})
+
+	vs, err := alloydb.NewVectorStore(pgEngine, nil, "precomputed_table")
+	require.NoError(t, err)
+
+	_, err = vs.AddVectors(ctx, [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, []schema.Document{
+		{PageContent: "x"}, {PageContent: "y"}, {PageContent: "z"},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearchByVector(ctx, []float32{0, 1, 0.1}, 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "y", docs[0].PageContent)
+
+	_, err = vs.SimilaritySearch(ctx, "y", 1)
+	require.ErrorIs(t, err, alloydb.ErrMissingEmbedder)
+}
+
+func TestContainerAddDocumentsOptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:     "options_table",
+		StoreMetadata: true,
+	})
+	initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:     "options_namespace_table",
+		StoreMetadata: true,
+	})
+
+	skipKyoto := func(_ context.Context, doc schema.Document) bool { return doc.PageContent == "Kyoto" }
+	ids, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo"}, {PageContent: "Kyoto"}, {PageContent: "Paris"},
+	},
+		vectorstores.WithNameSpace("options_namespace_table"),
+		vectorstores.WithDeduplicater(skipKyoto),
+		// Search-only options are ignored when adding documents.
+		vectorstores.WithScoreThreshold(0.5),
+		vectorstores.WithFilters("1 = 0"),
+	)
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 5)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+
+	docs, err = vs.SimilaritySearch(ctx, "Tokyo", 5, vectorstores.WithNameSpace("options_namespace_table"))
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Paris", docs[1].PageContent)
+}
+
+func TestContainerTenantColumn(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:       "tenant_table",
+		StoreMetadata:   true,
+		MetadataColumns: []alloydbutil.Column{{Name: "tenant_id", DataType: "text"}},
+	}, alloydb.WithTenantColumn("tenant_id"))
+
+	_, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}},
+		vectorstores.WithNameSpace("acme"))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Paris"}},
+		vectorstores.WithNameSpace("globex"))
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Paris", 5, vectorstores.WithNameSpace("acme"))
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, doc := range docs {
+		require.Contains(t, []string{"Tokyo", "Kyoto"}, doc.PageContent)
+	}
+
+	docs, err = vs.SimilaritySearch(ctx, "Tokyo", 5, vectorstores.WithNameSpace("globex"))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Paris", docs[0].PageContent)
+
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 5)
+	require.ErrorIs(t, err, alloydb.ErrMissingTenant)
+}
+
+func TestContainerDistanceMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		strategy      alloydb.VectorStoreOption
+		wantDistances []float32
+		wantScores    []float32
+	}{
+		{"cosine", alloydb.WithDistanceStrategy(alloydb.CosineDistance{}), []float32{0, 1}, []float32{1, 0}},
+		{"euclidean", alloydb.WithDistanceStrategy(alloydb.Euclidean{}), []float32{0, 1.4142135}, []float32{1, 0.41421357}},
+		{"inner_product", alloydb.WithDistanceStrategy(alloydb.InnerProduct{}), []float32{-1, 0}, []float32{1, 0}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+				TableName:     "distance_" + tc.name,
+				StoreMetadata: true,
+			}, tc.strategy)
+			_, err := vs.AddVectors(ctx, [][]float32{{1, 0, 0}, {0, 1, 0}},
+				[]schema.Document{{PageContent: "x"}, {PageContent: "y"}})
+			require.NoError(t, err)
+
+			docs, err := vs.SimilaritySearchByVector(ctx, []float32{1, 0, 0}, 2)
+			require.NoError(t, err)
+			require.Len(t, docs, 2)
+			for i, doc := range docs {
+				require.InDelta(t, tc.wantDistances[i], doc.Metadata[alloydb.DistanceMetadataKey], 1e-5)
+				require.InDelta(t, tc.wantScores[i], doc.Score, 1e-5)
+			}
+		})
+	}
+}
+
+func TestContainerMetadataFilter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+		TableName:     "metadata_filter_table",
+		StoreMetadata: true,
+	})
+
+	_, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan", "area": 2190}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"country": "Japan", "area": 827.8}},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France", "area": 105}},
+		{PageContent: "London", Metadata: map[string]any{"country": "UK", "area": 1572}},
+		{PageContent: "Sao Paulo", Metadata: map[string]any{"country": "Brazil", "area": 1523}},
+	})
+	require.NoError(t, err)
+
+	cities := func(docs []schema.Document) []string {
+		names := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			names = append(names, doc.PageContent)
+		}
+		return names
+	}
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 10, vectorstores.WithFilters(
+		alloydb.MetadataFilter{JSONKey: "area", Op: ">", Value: 1500}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Tokyo", "London", "Sao Paulo"}, cities(docs))
+
+	docs, err = vs.SimilaritySearch(ctx, "Tokyo", 10, vectorstores.WithFilters([]alloydb.MetadataFilter{
+		{JSONKey: "country", Op: "=", Value: "Japan"},
+		{JSONKey: "area", Op: "<", Value: 1000.5},
+	}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Kyoto"}, cities(docs))
+
+	docs, err = vs.SimilaritySearch(ctx, "Tokyo", 10, vectorstores.WithFilters(
+		alloydb.MetadataFilter{JSONKey: "country", Op: "!=", Value: "Japan"}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Paris", "London", "Sao Paulo"}, cities(docs))
+}
+
+func TestContainerEngineFromDSN(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine, err := alloydbutil.NewPostgresEngine(ctx, alloydbutil.WithDSN(preCheckEnvSetting(t)))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.Pool.Ping(ctx))
+	err = engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         "dsn_engine_table",
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	_, err = engine.Pool.Exec(ctx, `DROP TABLE IF EXISTS "dsn_engine_table"`)
+	require.NoError(t, err)
+}
+
+func TestContainerTransactionalAddDocuments(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "transactional_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		MetadataColumns:   []alloydbutil.Column{{Name: "country", DataType: "text", Nullable: false}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName,
+		alloydb.WithMetadataColumns([]string{"country"}), alloydb.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	countRows := func() int {
+		var count int
+		require.NoError(t, engine.Pool.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %q", tableName)).Scan(&count))
+		return count
+	}
+
+	// The second document has no country, violating the NOT NULL constraint.
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}},
+		{PageContent: "Atlantis"},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France"}},
+	})
+	require.Error(t, err)
+	require.Zero(t, countRows())
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, countRows())
+}
+
+func TestContainerReIndex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{TableName: "reindex_table"})
+
+	valid, err := vs.IsValidIndex(ctx, "missing_index")
+	require.NoError(t, err)
+	require.False(t, valid)
+
+	err = vs.ReIndexWithName(ctx, "missing_index")
+	require.ErrorIs(t, err, alloydb.ErrIndexNotFound)
+	require.ErrorContains(t, err, "missing_index")
+
+	idx := vs.NewBaseIndex("reindex_index", "hnsw", alloydb.CosineDistance{}, []string{}, alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "reindex_index", false))
+	require.NoError(t, vs.ReIndexWithName(ctx, "reindex_index"))
+	require.NoError(t, vs.DropVectorIndex(ctx, "reindex_index"))
+}
+
+func TestContainerReIndexMixedCase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{TableName: "ReIndex_Mixed_Table"})
+
+	// The default index name takes the table's mixed case, which Postgres
+	// folds to lower case.
+	defaultIdx := vs.NewBaseIndex("", "hnsw", alloydb.CosineDistance{}, []string{}, alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, defaultIdx, "", false))
+	require.NoError(t, vs.ReIndex(ctx))
+
+	idx := vs.NewBaseIndex("MyIndex", "hnsw", alloydb.CosineDistance{}, []string{}, alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "MyIndex", false))
+	valid, err := vs.IsValidIndex(ctx, "MyIndex")
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.NoError(t, vs.ReIndexWithName(ctx, "MyIndex"))
+	require.NoError(t, vs.DropVectorIndex(ctx, "MyIndex"))
+}
+
+func TestContainerStrategyRanking(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	// Against the query (1, 0, 0), "long" has the larger inner product while
+	// "aligned" points in almost the same direction and is closer.
+	vectors := [][]float32{{10, 10, 0}, {1, 0.1, 0}}
+	docs := []schema.Document{{PageContent: "long"}, {PageContent: "aligned"}}
+	tests := []struct {
+		name     string
+		strategy alloydb.VectorStoreOption
+		want     []string
+	}{
+		{"cosine", alloydb.WithDistanceStrategy(alloydb.CosineDistance{}), []string{"aligned", "long"}},
+		{"euclidean", alloydb.WithDistanceStrategy(alloydb.Euclidean{}), []string{"aligned", "long"}},
+		{"inner_product", alloydb.WithDistanceStrategy(alloydb.InnerProduct{}), []string{"long", "aligned"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, vs := initFakeVectorStore(t, alloydbutil.VectorstoreTableOptions{
+				TableName: "ranking_" + tc.name,
+			}, tc.strategy)
+			_, err := vs.AddVectors(ctx, vectors, docs)
+			require.NoError(t, err)
+
+			results, err := vs.SimilaritySearchByVector(ctx, []float32{1, 0, 0}, 2)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.Equal(t, tc.want, []string{results[0].PageContent, results[1].PageContent})
+			require.Greater(t, results[0].Score, results[1].Score)
+		})
+	}
+}
+
+func TestContainerEngineCloseContext(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{"drains in-flight query", 10 * time.Second, nil},
+		{"times out", 100 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			engine, err := alloydbutil.NewPostgresEngine(context.Background(), alloydbutil.WithDSN(preCheckEnvSetting(t)))
+			require.NoError(t, err)
+
+			started := make(chan struct{})
+			queryErr := make(chan error, 1)
+			go func() {
+				conn, err := engine.Pool.Acquire(context.Background())
+				close(started)
+				if err != nil {
+					queryErr <- err
+					return
+				}
+				defer conn.Release()
+				_, err = conn.Exec(context.Background(), "SELECT pg_sleep(1)")
+				queryErr <- err
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err = engine.CloseContext(ctx)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, <-queryErr)
+		})
+	}
+}
+
+func TestContainerByteaContentColumn(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	_, err := engine.Pool.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS vector`)
+	require.NoError(t, err)
+	_, err = engine.Pool.Exec(ctx, `DROP TABLE IF EXISTS "bytea_content_table";
+		CREATE TABLE "bytea_content_table" (
+			langchain_id UUID PRIMARY KEY,
+			content BYTEA NOT NULL,
+			embedding vector(3) NOT NULL,
+			langchain_metadata JSON
+		)`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), `DROP TABLE IF EXISTS "bytea_content_table"`)
+		require.NoError(t, err)
+	})
+	_, err = engine.Pool.Exec(ctx, `INSERT INTO "bytea_content_table" VALUES
+		(gen_random_uuid(), convert_to('Tokyo', 'UTF8'), '[1,0,0]', '{"country": "Japan"}')`)
+	require.NoError(t, err)
+
+	vs, err := alloydb.NewVectorStore(engine, nil, "bytea_content_table")
+	require.NoError(t, err)
+	docs, err := vs.SimilaritySearchByVector(ctx, []float32{1, 0, 0}, 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Japan", docs[0].Metadata["country"])
+}
+
+func TestContainerSearchReturnsMetadataColumns(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "metadata_columns_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		MetadataColumns: []alloydbutil.Column{
+			{Name: "country", DataType: "text", Nullable: true},
+			{Name: "area", DataType: "int", Nullable: true},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName,
+		alloydb.WithMetadataColumns([]string{"country", "area"}), alloydb.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan", "area": 2190}},
+		{PageContent: "Atlantis"},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 2)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Japan", docs[0].Metadata["country"])
+	require.EqualValues(t, 2190, docs[0].Metadata["area"])
+	require.NotContains(t, docs[1].Metadata, "country")
+}
+
+func TestContainerValidateIndexStrategy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "index_strategy_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	cosineStore, err := alloydb.NewVectorStore(engine, nil, tableName, alloydb.WithDistanceStrategy(alloydb.CosineDistance{}))
+	require.NoError(t, err)
+	l2Store, err := alloydb.NewVectorStore(engine, nil, tableName, alloydb.WithDistanceStrategy(alloydb.Euclidean{}))
+	require.NoError(t, err)
+
+	// Without an index there is nothing to mismatch.
+	require.NoError(t, cosineStore.ValidateIndexStrategy(ctx))
+
+	idx := l2Store.NewBaseIndex("l2_index", "hnsw", alloydb.Euclidean{}, []string{}, alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, l2Store.ApplyVectorIndex(ctx, idx, "l2_index", false))
+
+	require.NoError(t, l2Store.ValidateIndexStrategy(ctx))
+	err = cosineStore.ValidateIndexStrategy(ctx)
+	require.ErrorIs(t, err, alloydb.ErrIndexStrategyMismatch)
+	require.ErrorContains(t, err, "vector_l2_ops")
+}
+
+func TestContainerQueryHook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var mu sync.Mutex
+	var statements []string
+	completed := 0
+	hook := func(_ context.Context, sql string) func(error) {
+		mu.Lock()
+		defer mu.Unlock()
+		statements = append(statements, sql)
+		return func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.NoError(t, err)
+			completed++
+		}
+	}
+	engine, err := alloydbutil.NewPostgresEngine(ctx,
+		alloydbutil.WithDSN(preCheckEnvSetting(t)), alloydbutil.WithQueryHook(hook))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	tableName := "query_hook_table"
+	err = engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, len(statements), completed)
+	var inserted, searched bool
+	for _, sql := range statements {
+		inserted = inserted || strings.Contains(sql, "INSERT INTO") && strings.Contains(sql, tableName)
+		searched = searched || strings.Contains(sql, "SELECT") && strings.Contains(sql, tableName)
+	}
+	require.True(t, inserted, "insert not traced: %q", statements)
+	require.True(t, searched, "search not traced: %q", statements)
+}
+
+func TestContainerAddDocumentsKeepsMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "keeps_metadata_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+		MetadataColumns:   []alloydbutil.Column{{Name: "country", DataType: "text", Nullable: true}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithMetadataColumns([]string{"country"}))
+	require.NoError(t, err)
+
+	docs := []schema.Document{{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan", "area": 2190}}}
+	_, err = vs.AddDocuments(ctx, docs)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"country": "Japan", "area": 2190}, docs[0].Metadata)
+}
+
+func TestContainerVerifyTable(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "verify_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	require.NoError(t, vs.VerifyTable(ctx))
+
+	missingTable, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, "no_such_table")
+	require.NoError(t, err)
+	require.ErrorIs(t, missingTable.VerifyTable(ctx), alloydb.ErrTableNotFound)
+
+	missingColumn, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithEmbeddingColumn("vector"))
+	require.NoError(t, err)
+	err = missingColumn.VerifyTable(ctx)
+	require.ErrorIs(t, err, alloydb.ErrInvalidTableSchema)
+	require.ErrorContains(t, err, `embedding column "vector" not found`)
+
+	wrongType, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithEmbeddingColumn("content"))
+	require.NoError(t, err)
+	err = wrongType.VerifyTable(ctx)
+	require.ErrorIs(t, err, alloydb.ErrInvalidTableSchema)
+	require.ErrorContains(t, err, `embedding column "content" has type text`)
+}
+
+func TestContainerSparseVectors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "sparse_vector_table"
+	_, err := engine.Pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE %q (
+		langchain_id UUID PRIMARY KEY,
+		content TEXT NOT NULL,
+		sparse_embedding sparsevec(5) NOT NULL,
+		langchain_metadata JSON)`, tableName))
+	if err != nil && strings.Contains(err.Error(), "sparsevec") {
+		t.Skipf("pgvector does not support sparsevec: %v", err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, nil, tableName,
+		alloydb.WithSparseEmbeddingColumn("sparse_embedding", 5))
+	require.NoError(t, err)
+
+	_, err = vs.AddSparseVectors(ctx, []map[int]float32{
+		{0: 1, 3: 0.5}, {1: 1}, {4: 2},
+	}, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}}, {PageContent: "Paris"}, {PageContent: "Berlin"},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.SparseSimilaritySearch(ctx, map[int]float32{0: 1, 3: 0.4}, 2)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Japan", docs[0].Metadata["country"])
+	require.Greater(t, docs[0].Score, docs[1].Score)
+}
+
+func TestContainerListVectorstoreTables(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	schemaName := "list_tables_schema"
+	_, err := engine.Pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %q", schemaName))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA IF EXISTS %q CASCADE", schemaName))
+		require.NoError(t, err)
+	})
+	for tableName, size := range map[string]int{"small_vectors": 3, "large_vectors": 768} {
+		err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+			TableName:         tableName,
+			SchemaName:        schemaName,
+			VectorSize:        size,
+			OverwriteExisting: true,
+		})
+		require.NoError(t, err)
+	}
+
+	tables, err := engine.ListVectorstoreTables(ctx, schemaName)
+	require.NoError(t, err)
+	require.Equal(t, []alloydbutil.TableInfo{
+		{TableName: "large_vectors", VectorColumn: "embedding", Dimensions: 768},
+		{TableName: "small_vectors", VectorColumn: "embedding", Dimensions: 3},
+	}, tables)
+}
+
+func TestContainerDeleteByFilter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "delete_by_filter_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"area": 2190}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"area": 828}},
+		{PageContent: "Paris", Metadata: map[string]any{"area": 105}},
+		{PageContent: "Berlin", Metadata: map[string]any{"area": 891}},
+		{PageContent: "Sydney", Metadata: map[string]any{"area": 12368}},
+	})
+	require.NoError(t, err)
+
+	_, err = vs.DeleteByFilter(ctx, []alloydb.MetadataFilter{})
+	require.ErrorIs(t, err, alloydb.ErrEmptyDeleteFilter)
+	_, err = vs.DeleteByFilter(ctx, "true")
+	require.ErrorIs(t, err, alloydb.ErrInvalidMetadataFilter)
+
+	deleted, err := vs.DeleteByFilter(ctx, alloydb.MetadataFilter{JSONKey: "area", Op: ">", Value: 1500})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 10)
+	require.NoError(t, err)
+	remaining := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		remaining = append(remaining, doc.PageContent)
+	}
+	require.ElementsMatch(t, []string{"Kyoto", "Paris", "Berlin"}, remaining)
+}
+
+func TestContainerIDGenerator(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableNames := []string{"content_hash_table", "content_hash_copy_table"}
+	for _, tableName := range tableNames {
+		err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+			TableName:         tableName,
+			VectorSize:        testVectorSize,
+			OverwriteExisting: true,
+			IDColumn:          alloydbutil.Column{Name: "langchain_id", DataType: "TEXT"},
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+			require.NoError(t, err)
+		})
+	}
+	contentHash := func(doc schema.Document) (string, error) {
+		sum := sha256.Sum256([]byte(doc.PageContent))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableNames[0],
+		alloydb.WithIDGenerator(contentHash), alloydb.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	ids, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	copyIDs, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}}, vectorstores.WithNameSpace(tableNames[1]))
+	require.NoError(t, err)
+	wantID, err := contentHash(schema.Document{PageContent: "Tokyo"})
+	require.NoError(t, err)
+	require.Equal(t, wantID, ids[0])
+	require.Equal(t, ids[0], copyIDs[0])
+	require.NotEqual(t, ids[0], ids[1])
+
+	// The same content maps to the same id, which the primary key rejects.
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.Error(t, err)
+}
+
+func TestContainerEmbeddingDimension(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "embedding_dimension_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	// The dimension is detected from the vector(3) column.
+	_, err = vs.AddVectors(ctx, [][]float32{{1, 0, 0, 0}}, []schema.Document{{PageContent: "Tokyo"}})
+	require.ErrorIs(t, err, alloydb.ErrEmbeddingDimensionMismatch)
+	require.ErrorContains(t, err, "embedding dimension 4 does not match column dimension 3")
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+}
+
+func TestContainerReadAfterWrite(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "read_after_write_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("read_after_write_index", "hnsw", alloydb.CosineDistance{}, []string{},
+		alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "read_after_write_index", true))
+
+	for _, content := range []string{"Tokyo", "Kyoto", "Osaka"} {
+		_, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: content}})
+		require.NoError(t, err)
+		docs, err := vs.SimilaritySearch(ctx, content, 1)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, content, docs[0].PageContent)
+	}
+}
+
+func TestContainerEFSearch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "ef_search_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithEFSearch(100))
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("ef_search_index", "hnsw", alloydb.CosineDistance{}, []string{},
+		alloydb.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "ef_search_index", false))
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+}
+
+func TestContainerProbes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "probes_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithProbes(2))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("probes_index", "ivfflat", alloydb.CosineDistance{}, []string{}, alloydb.IVFFlatOptions{Lists: 2})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "probes_index", false))
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+}
+
+func TestContainerSearchTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "timeout_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+
+	// The filter makes the query sleep well past the search timeout.
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1,
+		vectorstores.WithFilters("pg_sleep(5) IS NOT NULL"),
+		vectorstores.WithTimeout(100*time.Millisecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestContainerPoolAcquireTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "pool_acquire_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	config, err := pgxpool.ParseConfig(preCheckEnvSetting(t))
+	require.NoError(t, err)
+	config.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+	smallEngine, err := alloydbutil.NewPostgresEngine(ctx, alloydbutil.WithPool(pool))
+	require.NoError(t, err)
+	vs, err := alloydb.NewVectorStore(smallEngine, fakeEmbedder{}, tableName,
+		alloydb.WithPoolAcquireTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+
+	// Holding the only connection makes the search wait for the pool.
+	conn, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.ErrorIs(t, err, alloydb.ErrPoolExhausted)
+	require.ErrorContains(t, err, "connection pool exhausted")
+
+	conn.Release()
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+}
+
+func TestContainerExportAll(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "export_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	texts := []string{"Tokyo", "Kyoto", "Paris", "Berlin", "Madrid"}
+	docs := make([]schema.Document, len(texts))
+	for i, text := range texts {
+		docs[i] = schema.Document{PageContent: text, Metadata: map[string]any{"rank": i}}
+	}
+	ids, err := vs.AddDocuments(ctx, docs)
+	require.NoError(t, err)
+
+	seq, err := vs.ExportAll(ctx, 2)
+	require.NoError(t, err)
+	exported := map[string]schema.Document{}
+	seq(func(doc schema.Document, err error) bool {
+		require.NoError(t, err)
+		exported[doc.Metadata["id"].(string)] = doc
+		return true
+	})
+	require.Len(t, exported, len(texts))
+	for i, id := range ids {
+		doc, ok := exported[id]
+		require.True(t, ok)
+		require.Equal(t, texts[i], doc.PageContent)
+		require.InDelta(t, float64(i), doc.Metadata["rank"], 0)
+		want, err := fakeEmbedder{}.EmbedQuery(ctx, texts[i])
+		require.NoError(t, err)
+		require.Equal(t, want, doc.Metadata[alloydb.EmbeddingMetadataKey])
+	}
+}
+
+func TestContainerDeduplicate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "deduplicate_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName, alloydb.WithDeduplicate())
+	require.NoError(t, err)
+
+	first, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	second, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	require.Len(t, second, 3)
+	require.Equal(t, first[0], second[0])
+	require.NotEqual(t, first[0], second[1])
+	require.Equal(t, second[1], second[2])
+
+	var count int
+	err = engine.Pool.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %q", tableName)).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestContainerDeduplicateByteaContent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	_, err := engine.Pool.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS vector`)
+	require.NoError(t, err)
+	_, err = engine.Pool.Exec(ctx, `DROP TABLE IF EXISTS "deduplicate_bytea_table";
+		CREATE TABLE "deduplicate_bytea_table" (
+			langchain_id UUID PRIMARY KEY,
+			content BYTEA NOT NULL,
+			embedding vector(3) NOT NULL,
+			langchain_metadata JSON
+		)`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), `DROP TABLE IF EXISTS "deduplicate_bytea_table"`)
+		require.NoError(t, err)
+	})
+	var storedID string
+	err = engine.Pool.QueryRow(ctx, `INSERT INTO "deduplicate_bytea_table" VALUES
+		(gen_random_uuid(), convert_to('Tokyo', 'UTF8'), '[1,0,0]', '{}') RETURNING langchain_id::text`).Scan(&storedID)
+	require.NoError(t, err)
+
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, "deduplicate_bytea_table", alloydb.WithDeduplicate())
+	require.NoError(t, err)
+	ids, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{storedID}, ids)
+}
+
+func TestContainerConcurrentUse(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "concurrent_table"
+	err := engine.InitVectorstoreTable(ctx, alloydbutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := alloydb.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	// The goroutines share the same documents and metadata.
+	docs := []schema.Document{{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}}}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := vs.AddDocuments(ctx, docs)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	results, err := vs.SimilaritySearch(ctx, "Tokyo", 2*workers)
+	require.NoError(t, err)
+	require.Len(t, results, workers)
+	require.Equal(t, map[string]any{"country": "Japan"}, docs[0].Metadata)
+}
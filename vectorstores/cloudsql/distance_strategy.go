@@ -7,6 +7,9 @@ type distanceStrategy interface {
 	operator() string
 	searchFunction() string
 	similaritySearchFunction() string
+	// similarity converts a distance returned by operator into a score where
+	// higher means more similar.
+	similarity(distance float32) float32
 }
 
 type Index interface {
@@ -31,6 +34,10 @@ func (Euclidean) similaritySearchFunction() string {
 	return "l2_distance"
 }
 
+func (Euclidean) similarity(distance float32) float32 {
+	return 1 / (1 + distance)
+}
+
 type CosineDistance struct{}
 
 func (CosineDistance) String() string {
@@ -49,6 +56,10 @@ func (CosineDistance) similaritySearchFunction() string {
 	return "cosine_distance"
 }
 
+func (CosineDistance) similarity(distance float32) float32 {
+	return 1 - distance
+}
+
 type InnerProduct struct{}
 
 func (InnerProduct) String() string {
@@ -67,6 +78,11 @@ func (InnerProduct) similaritySearchFunction() string {
 	return "inner_product"
 }
 
+// similarity undoes the negation of the <#> operator, giving the inner product.
+func (InnerProduct) similarity(distance float32) float32 {
+	return -distance
+}
+
 // HNSWOptions holds the configuration for the hnsw index.
 type HNSWOptions struct {
 	M              int
@@ -0,0 +1,93 @@
+package cloudsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/averikitsch/langchaingo/schema"
+	"github.com/averikitsch/langchaingo/vectorstores"
+)
+
+// ErrInvalidSparseVector is returned when a sparse vector has an index
+// outside the dimensions of the store's sparse embedding column.
+var ErrInvalidSparseVector = errors.New("invalid sparse vector")
+
+// AddSparseVectors adds documents with precomputed sparse embeddings, such as
+// SPLADE term weights, to the sparse embedding column set by
+// WithSparseEmbeddingColumn, and returns the ids of the added documents. Each
+// vector maps zero-based dimensions to their non-zero values. The dense
+// embedding column is not written, so it must be nullable or absent. Options
+// are handled as in AddVectors.
+func (vs *VectorStore) AddSparseVectors(ctx context.Context, vectors []map[int]float32, docs []schema.Document,
+	options ...vectorstores.Option,
+) ([]string, error) {
+	if len(vectors) != len(docs) {
+		return nil, ErrEmbedderWrongNumberVectors
+	}
+	sparse, err := vs.sparseStore()
+	if err != nil {
+		return nil, err
+	}
+	literals := make([]string, len(vectors))
+	for i, vector := range vectors {
+		if literals[i], err = sparseVectorLiteral(vector, vs.sparseDimensions); err != nil {
+			return nil, err
+		}
+	}
+	return sparse.addVectorLiterals(ctx, literals, docs, options...)
+}
+
+// SparseSimilaritySearch searches the sparse embedding column set by
+// WithSparseEmbeddingColumn for the documents closest to the given sparse
+// vector under the store's distance strategy. Options are handled as in
+// SimilaritySearchByVector.
+func (vs *VectorStore) SparseSimilaritySearch(ctx context.Context, vector map[int]float32, numDocuments int,
+	options ...vectorstores.Option,
+) ([]schema.Document, error) {
+	sparse, err := vs.sparseStore()
+	if err != nil {
+		return nil, err
+	}
+	literal, err := sparseVectorLiteral(vector, vs.sparseDimensions)
+	if err != nil {
+		return nil, err
+	}
+	return sparse.similaritySearchByLiteral(ctx, literal, numDocuments, options...)
+}
+
+// sparseStore returns a copy of the store that uses the sparse embedding
+// column in place of the dense one. The pgvector distance operators and
+// functions are the same for both.
+func (vs *VectorStore) sparseStore() (*VectorStore, error) {
+	if vs.sparseEmbeddingColumn == "" {
+		return nil, fmt.Errorf("%w: store has no sparse embedding column", ErrUnsupportedOptions)
+	}
+	sparse := *vs
+	sparse.embeddingColumn = vs.sparseEmbeddingColumn
+	return &sparse, nil
+}
+
+// sparseVectorLiteral formats a sparse vector as a pgvector sparsevec
+// literal such as {1:0.5,3:2}/5, whose indices are one-based and ascending.
+// Zero values are omitted.
+func sparseVectorLiteral(vector map[int]float32, dimensions int) (string, error) {
+	indices := make([]int, 0, len(vector))
+	for index, value := range vector {
+		if index < 0 || index >= dimensions {
+			return "", fmt.Errorf("%w: index %d is outside %d dimensions", ErrInvalidSparseVector, index, dimensions)
+		}
+		if value != 0 {
+			indices = append(indices, index)
+		}
+	}
+	slices.Sort(indices)
+	elements := make([]string, len(indices))
+	for i, index := range indices {
+		elements[i] = strconv.Itoa(index+1) + ":" + strconv.FormatFloat(float64(vector[index]), 'f', -1, 32)
+	}
+	return fmt.Sprintf("{%s}/%d", strings.Join(elements, ","), dimensions), nil
+}
@@ -0,0 +1,1256 @@
+package cloudsql_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/averikitsch/langchaingo/schema"
+	"github.com/averikitsch/langchaingo/util/cloudsqlutil"
+	"github.com/averikitsch/langchaingo/vectorstores"
+	"github.com/averikitsch/langchaingo/vectorstores/cloudsql"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const testVectorSize = 3
+
+// fakeEmbedder returns deterministic embeddings so container tests don't
+// depend on an external embedding provider.
+type fakeEmbedder struct{}
+
+func (e fakeEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		v, err := e.EmbedQuery(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	v := make([]float32, testVectorSize)
+	for i, r := range text {
+		v[i%testVectorSize] += float32(r)
+	}
+	return v, nil
+}
+
+func preCheckEnvSetting(t *testing.T) string {
+	t.Helper()
+
+	pgvectorURL := os.Getenv("PGVECTOR_CONNECTION_STRING")
+	if pgvectorURL == "" {
+		pgVectorContainer, err := tcpostgres.RunContainer(
+			context.Background(),
+			testcontainers.WithImage("docker.io/pgvector/pgvector:pg16"),
+			tcpostgres.WithDatabase("db_test"),
+			tcpostgres.WithUsername("user"),
+			tcpostgres.WithPassword("passw0rd!"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second)),
+		)
+		if err != nil && strings.Contains(err.Error(), "Cannot connect to the Docker daemon") {
+			t.Skip("Docker not available")
+		}
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, pgVectorContainer.Terminate(context.Background()))
+		})
+
+		str, err := pgVectorContainer.ConnectionString(context.Background(), "sslmode=disable")
+		require.NoError(t, err)
+
+		pgvectorURL = str
+	}
+
+	return pgvectorURL
+}
+
+func setEngineWithImage(t *testing.T) cloudsqlutil.PostgresEngine {
+	t.Helper()
+	pgvectorURL := preCheckEnvSetting(t)
+	ctx := context.Background()
+	myPool, err := pgxpool.New(ctx, pgvectorURL)
+	if err != nil {
+		t.Fatal("Could not set Engine: ", err)
+	}
+	pgEngine, err := cloudsqlutil.NewPostgresEngine(ctx,
+		cloudsqlutil.WithPool(myPool),
+	)
+	if err != nil {
+		t.Fatal("Could not set Engine: ", err)
+	}
+
+	return pgEngine
+}
+
+func initVectorStore(t *testing.T, opts ...cloudsql.VectorStoreOption) (cloudsql.VectorStore, func() error) {
+	t.Helper()
+	pgEngine := setEngineWithImage(t)
+	ctx := context.Background()
+	vectorstoreTableoptions := cloudsqlutil.VectorstoreTableOptions{
+		TableName:         "my_test_table",
+		OverwriteExisting: true,
+		VectorSize:        testVectorSize,
+		StoreMetadata:     true,
+	}
+	err := pgEngine.InitVectorstoreTable(ctx, vectorstoreTableoptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err := cloudsql.NewVectorStore(pgEngine, fakeEmbedder{}, "my_test_table", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanUpTableFn := func() error {
+		_, err := pgEngine.Pool.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", "my_test_table"))
+		return err
+	}
+	return vs, cleanUpTableFn
+}
+
+func TestContainerApplyVectorIndex(t *testing.T) {
+	t.Parallel()
+	vs, cleanUpTableFn := initVectorStore(t)
+	t.Cleanup(func() {
+		if err := cleanUpTableFn(); err != nil {
+			t.Fatal("Cleanup failed:", err)
+		}
+	})
+	ctx := context.Background()
+
+	tcs := []struct {
+		name    string
+		index   string
+		options cloudsql.Index
+	}{
+		{name: "hnswindex", index: "hnsw", options: cloudsql.HNSWOptions{M: 4, EfConstruction: 16}},
+		{name: "ivfflatindex", index: "ivfflat", options: cloudsql.IVFFlatOptions{Lists: 1}},
+	}
+	for _, tc := range tcs {
+		idx := vs.NewBaseIndex(tc.name, tc.index, cloudsql.CosineDistance{}, []string{}, tc.options)
+		require.NoError(t, vs.ApplyVectorIndex(ctx, idx, tc.name, false))
+
+		isValid, err := vs.IsValidIndex(ctx, tc.name)
+		require.NoError(t, err)
+		require.True(t, isValid)
+
+		require.NoError(t, vs.DropVectorIndex(ctx, tc.name))
+	}
+}
+
+func TestContainerAsRetriever(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	vs, cleanUpTableFn := initVectorStore(t)
+	t.Cleanup(func() {
+		require.NoError(t, cleanUpTableFn())
+	})
+
+	_, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"continent": "asia"}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"continent": "asia"}},
+		{PageContent: "Paris", Metadata: map[string]any{"continent": "europe"}},
+		{PageContent: "London", Metadata: map[string]any{"continent": "europe"}},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.AsRetriever(2).GetRelevantDocuments(ctx, "Tokyo")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+
+	docs, err = vs.AsRetriever(4, vectorstores.WithFilters("langchain_metadata->>'continent' = 'europe'")).
+		GetRelevantDocuments(ctx, "Tokyo")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, doc := range docs {
+		require.Contains(t, []string{"Paris", "London"}, doc.PageContent)
+	}
+}
+
+func TestContainerTenantColumn(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pgEngine := setEngineWithImage(t)
+	err := pgEngine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         "tenant_table",
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+		MetadataColumns:   []cloudsqlutil.Column{{Name: "tenant_id", DataType: "text"}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := pgEngine.Pool.Exec(context.Background(), "DROP TABLE IF EXISTS tenant_table")
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(pgEngine, fakeEmbedder{}, "tenant_table", cloudsql.WithTenantColumn("tenant_id"))
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}},
+		vectorstores.WithNameSpace("acme"))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Paris"}},
+		vectorstores.WithNameSpace("globex"))
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Paris", 5, vectorstores.WithNameSpace("acme"))
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	for _, doc := range docs {
+		require.Contains(t, []string{"Tokyo", "Kyoto"}, doc.PageContent)
+	}
+
+	docs, err = vs.SimilaritySearch(ctx, "Tokyo", 5, vectorstores.WithNameSpace("globex"))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Paris", docs[0].PageContent)
+
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 5)
+	require.ErrorIs(t, err, cloudsql.ErrMissingTenant)
+}
+
+func TestContainerEngineFromDSN(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine, err := cloudsqlutil.NewPostgresEngine(ctx, cloudsqlutil.WithDSN(preCheckEnvSetting(t)))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.Pool.Ping(ctx))
+	err = engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         "dsn_engine_table",
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	_, err = engine.Pool.Exec(ctx, `DROP TABLE IF EXISTS "dsn_engine_table"`)
+	require.NoError(t, err)
+}
+
+func TestContainerTransactionalAddDocuments(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "transactional_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		MetadataColumns:   []cloudsqlutil.Column{{Name: "country", DataType: "text", Nullable: false}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName,
+		cloudsql.WithMetadataColumns([]string{"country"}), cloudsql.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	countRows := func() int {
+		var count int
+		require.NoError(t, engine.Pool.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %q", tableName)).Scan(&count))
+		return count
+	}
+
+	// The second document has no country, violating the NOT NULL constraint.
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}},
+		{PageContent: "Atlantis"},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France"}},
+	})
+	require.Error(t, err)
+	require.Zero(t, countRows())
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, countRows())
+}
+
+func TestContainerReIndex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "reindex_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	valid, err := vs.IsValidIndex(ctx, "missing_index")
+	require.NoError(t, err)
+	require.False(t, valid)
+
+	err = vs.ReIndexWithName(ctx, "missing_index")
+	require.ErrorIs(t, err, cloudsql.ErrIndexNotFound)
+	require.ErrorContains(t, err, "missing_index")
+
+	idx := vs.NewBaseIndex("reindex_index", "hnsw", cloudsql.CosineDistance{}, []string{}, cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "reindex_index", false))
+	require.NoError(t, vs.ReIndexWithName(ctx, "reindex_index"))
+	require.NoError(t, vs.DropVectorIndex(ctx, "reindex_index"))
+}
+
+func TestContainerReIndexMixedCase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "ReIndex_Mixed_Table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	// The default index name takes the table's mixed case, which Postgres
+	// folds to lower case.
+	defaultIdx := vs.NewBaseIndex("", "hnsw", cloudsql.CosineDistance{}, []string{}, cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, defaultIdx, "", false))
+	require.NoError(t, vs.ReIndex(ctx))
+
+	idx := vs.NewBaseIndex("MyIndex", "hnsw", cloudsql.CosineDistance{}, []string{}, cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "MyIndex", false))
+	valid, err := vs.IsValidIndex(ctx, "MyIndex")
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.NoError(t, vs.ReIndexWithName(ctx, "MyIndex"))
+	require.NoError(t, vs.DropVectorIndex(ctx, "MyIndex"))
+}
+
+func TestContainerStrategyRanking(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	// Against the query (1, 0, 0), "long" has the larger inner product while
+	// "aligned" points in almost the same direction and is closer.
+	vectors := [][]float32{{10, 10, 0}, {1, 0.1, 0}}
+	docs := []schema.Document{{PageContent: "long"}, {PageContent: "aligned"}}
+	tests := []struct {
+		name     string
+		strategy cloudsql.VectorStoreOption
+		want     []string
+	}{
+		{"cosine", cloudsql.WithDistanceStrategy(cloudsql.CosineDistance{}), []string{"aligned", "long"}},
+		{"euclidean", cloudsql.WithDistanceStrategy(cloudsql.Euclidean{}), []string{"aligned", "long"}},
+		{"inner_product", cloudsql.WithDistanceStrategy(cloudsql.InnerProduct{}), []string{"long", "aligned"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			engine := setEngineWithImage(t)
+			tableName := "ranking_" + tc.name
+			err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+				TableName:         tableName,
+				VectorSize:        testVectorSize,
+				OverwriteExisting: true,
+			})
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+				require.NoError(t, err)
+			})
+			vs, err := cloudsql.NewVectorStore(engine, nil, tableName, tc.strategy)
+			require.NoError(t, err)
+			_, err = vs.AddVectors(ctx, vectors, docs)
+			require.NoError(t, err)
+
+			results, err := vs.SimilaritySearchByVector(ctx, []float32{1, 0, 0}, 2)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.Equal(t, tc.want, []string{results[0].PageContent, results[1].PageContent})
+			require.Greater(t, results[0].Score, results[1].Score)
+		})
+	}
+}
+
+func TestContainerAddDocumentsReturnsIDs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "add_documents_ids_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+		MetadataColumns:   []cloudsqlutil.Column{{Name: "country", DataType: "text", Nullable: true}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName,
+		cloudsql.WithMetadataColumns([]string{"country"}))
+	require.NoError(t, err)
+
+	const givenID = "6f1d7e4a-3c0b-4d59-9a3e-1b2c3d4e5f60"
+	ids, err := vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"id": givenID, "country": "Japan"}},
+		{PageContent: "Paris", Metadata: map[string]any{"country": "France"}},
+		{PageContent: "Lima"},
+	})
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+	require.Equal(t, givenID, ids[0])
+	require.NotEmpty(t, ids[1])
+	require.NotEqual(t, ids[1], ids[2])
+
+	for i, want := range []struct{ content, country string }{
+		{"Tokyo", "Japan"}, {"Paris", "France"}, {"Lima", ""},
+	} {
+		var content string
+		var country *string
+		err := engine.Pool.QueryRow(ctx,
+			fmt.Sprintf(`SELECT content, country FROM %q WHERE langchain_id = $1`, tableName), ids[i]).
+			Scan(&content, &country)
+		require.NoError(t, err)
+		require.Equal(t, want.content, content)
+		if want.country == "" {
+			require.Nil(t, country)
+		} else {
+			require.Equal(t, want.country, *country)
+		}
+	}
+}
+
+func TestContainerEngineCloseContext(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{"drains in-flight query", 10 * time.Second, nil},
+		{"times out", 100 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			engine, err := cloudsqlutil.NewPostgresEngine(context.Background(), cloudsqlutil.WithDSN(preCheckEnvSetting(t)))
+			require.NoError(t, err)
+
+			started := make(chan struct{})
+			queryErr := make(chan error, 1)
+			go func() {
+				conn, err := engine.Pool.Acquire(context.Background())
+				close(started)
+				if err != nil {
+					queryErr <- err
+					return
+				}
+				defer conn.Release()
+				_, err = conn.Exec(context.Background(), "SELECT pg_sleep(1)")
+				queryErr <- err
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err = engine.CloseContext(ctx)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, <-queryErr)
+		})
+	}
+}
+
+func TestContainerSearchReturnsMetadataColumns(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "metadata_columns_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		MetadataColumns: []cloudsqlutil.Column{
+			{Name: "country", DataType: "text", Nullable: true},
+			{Name: "area", DataType: "int", Nullable: true},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName,
+		cloudsql.WithMetadataColumns([]string{"country", "area"}), cloudsql.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan", "area": 2190}},
+		{PageContent: "Atlantis"},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 2)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Japan", docs[0].Metadata["country"])
+	require.EqualValues(t, 2190, docs[0].Metadata["area"])
+	require.NotContains(t, docs[1].Metadata, "country")
+}
+
+func TestContainerSimilaritySearchWithScore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "search_with_score_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo"}, {PageContent: "Kyoto"}, {PageContent: "Paris"},
+	})
+	require.NoError(t, err)
+
+	docs, scores, err := vs.SimilaritySearchWithScore(ctx, "Tokyo", 3)
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	require.Len(t, scores, 3)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	for i, doc := range docs {
+		require.InDelta(t, doc.Score, scores[i], 1e-6)
+		if i > 0 {
+			require.GreaterOrEqual(t, scores[i-1], scores[i])
+		}
+	}
+}
+
+func TestContainerValidateIndexStrategy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "index_strategy_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	cosineStore, err := cloudsql.NewVectorStore(engine, nil, tableName, cloudsql.WithDistanceStrategy(cloudsql.CosineDistance{}))
+	require.NoError(t, err)
+	l2Store, err := cloudsql.NewVectorStore(engine, nil, tableName, cloudsql.WithDistanceStrategy(cloudsql.Euclidean{}))
+	require.NoError(t, err)
+
+	// Without an index there is nothing to mismatch.
+	require.NoError(t, cosineStore.ValidateIndexStrategy(ctx))
+
+	idx := l2Store.NewBaseIndex("l2_index", "hnsw", cloudsql.Euclidean{}, []string{}, cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, l2Store.ApplyVectorIndex(ctx, idx, "l2_index", false))
+
+	require.NoError(t, l2Store.ValidateIndexStrategy(ctx))
+	err = cosineStore.ValidateIndexStrategy(ctx)
+	require.ErrorIs(t, err, cloudsql.ErrIndexStrategyMismatch)
+	require.ErrorContains(t, err, "vector_l2_ops")
+}
+
+func TestContainerQueryHook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var mu sync.Mutex
+	var statements []string
+	completed := 0
+	hook := func(_ context.Context, sql string) func(error) {
+		mu.Lock()
+		defer mu.Unlock()
+		statements = append(statements, sql)
+		return func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.NoError(t, err)
+			completed++
+		}
+	}
+	engine, err := cloudsqlutil.NewPostgresEngine(ctx,
+		cloudsqlutil.WithDSN(preCheckEnvSetting(t)), cloudsqlutil.WithQueryHook(hook))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	tableName := "query_hook_table"
+	err = engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, len(statements), completed)
+	var inserted, searched bool
+	for _, sql := range statements {
+		inserted = inserted || strings.Contains(sql, "INSERT INTO") && strings.Contains(sql, tableName)
+		searched = searched || strings.Contains(sql, "SELECT") && strings.Contains(sql, tableName)
+	}
+	require.True(t, inserted, "insert not traced: %q", statements)
+	require.True(t, searched, "search not traced: %q", statements)
+}
+
+func TestContainerAddDocumentsKeepsMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "keeps_metadata_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+		MetadataColumns:   []cloudsqlutil.Column{{Name: "country", DataType: "text", Nullable: true}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithMetadataColumns([]string{"country"}))
+	require.NoError(t, err)
+
+	docs := []schema.Document{{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan", "area": 2190}}}
+	_, err = vs.AddDocuments(ctx, docs)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"country": "Japan", "area": 2190}, docs[0].Metadata)
+}
+
+func TestContainerVerifyTable(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "verify_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	require.NoError(t, vs.VerifyTable(ctx))
+
+	missingTable, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, "no_such_table")
+	require.NoError(t, err)
+	require.ErrorIs(t, missingTable.VerifyTable(ctx), cloudsql.ErrTableNotFound)
+
+	missingColumn, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithEmbeddingColumn("vector"))
+	require.NoError(t, err)
+	err = missingColumn.VerifyTable(ctx)
+	require.ErrorIs(t, err, cloudsql.ErrInvalidTableSchema)
+	require.ErrorContains(t, err, `embedding column "vector" not found`)
+
+	wrongType, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithEmbeddingColumn("content"))
+	require.NoError(t, err)
+	err = wrongType.VerifyTable(ctx)
+	require.ErrorIs(t, err, cloudsql.ErrInvalidTableSchema)
+	require.ErrorContains(t, err, `embedding column "content" has type text`)
+}
+
+func TestContainerSparseVectors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "sparse_vector_table"
+	_, err := engine.Pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE %q (
+		langchain_id UUID PRIMARY KEY,
+		content TEXT NOT NULL,
+		sparse_embedding sparsevec(5) NOT NULL,
+		langchain_metadata JSON)`, tableName))
+	if err != nil && strings.Contains(err.Error(), "sparsevec") {
+		t.Skipf("pgvector does not support sparsevec: %v", err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, nil, tableName,
+		cloudsql.WithSparseEmbeddingColumn("sparse_embedding", 5))
+	require.NoError(t, err)
+
+	_, err = vs.AddSparseVectors(ctx, []map[int]float32{
+		{0: 1, 3: 0.5}, {1: 1}, {4: 2},
+	}, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}}, {PageContent: "Paris"}, {PageContent: "Berlin"},
+	})
+	require.NoError(t, err)
+
+	docs, err := vs.SparseSimilaritySearch(ctx, map[int]float32{0: 1, 3: 0.4}, 2)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+	require.Equal(t, "Japan", docs[0].Metadata["country"])
+	require.Greater(t, docs[0].Score, docs[1].Score)
+}
+
+func TestContainerListVectorstoreTables(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	schemaName := "list_tables_schema"
+	_, err := engine.Pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %q", schemaName))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA IF EXISTS %q CASCADE", schemaName))
+		require.NoError(t, err)
+	})
+	for tableName, size := range map[string]int{"small_vectors": 3, "large_vectors": 768} {
+		err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+			TableName:         tableName,
+			SchemaName:        schemaName,
+			VectorSize:        size,
+			OverwriteExisting: true,
+		})
+		require.NoError(t, err)
+	}
+
+	tables, err := engine.ListVectorstoreTables(ctx, schemaName)
+	require.NoError(t, err)
+	require.Equal(t, []cloudsqlutil.TableInfo{
+		{TableName: "large_vectors", VectorColumn: "embedding", Dimensions: 768},
+		{TableName: "small_vectors", VectorColumn: "embedding", Dimensions: 3},
+	}, tables)
+}
+
+func TestContainerDeleteByFilter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "delete_by_filter_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo", Metadata: map[string]any{"area": 2190}},
+		{PageContent: "Kyoto", Metadata: map[string]any{"area": 828}},
+		{PageContent: "Paris", Metadata: map[string]any{"area": 105}},
+		{PageContent: "Berlin", Metadata: map[string]any{"area": 891}},
+		{PageContent: "Sydney", Metadata: map[string]any{"area": 12368}},
+	})
+	require.NoError(t, err)
+
+	_, err = vs.DeleteByFilter(ctx, []cloudsql.MetadataFilter{})
+	require.ErrorIs(t, err, cloudsql.ErrEmptyDeleteFilter)
+	_, err = vs.DeleteByFilter(ctx, "true")
+	require.ErrorIs(t, err, cloudsql.ErrInvalidMetadataFilter)
+
+	deleted, err := vs.DeleteByFilter(ctx, cloudsql.MetadataFilter{JSONKey: "area", Op: ">", Value: 1500})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 10)
+	require.NoError(t, err)
+	remaining := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		remaining = append(remaining, doc.PageContent)
+	}
+	require.ElementsMatch(t, []string{"Kyoto", "Paris", "Berlin"}, remaining)
+}
+
+func TestContainerIDGenerator(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableNames := []string{"content_hash_table", "content_hash_copy_table"}
+	for _, tableName := range tableNames {
+		err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+			TableName:         tableName,
+			VectorSize:        testVectorSize,
+			OverwriteExisting: true,
+			IDColumn:          cloudsqlutil.Column{Name: "langchain_id", DataType: "TEXT"},
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+			require.NoError(t, err)
+		})
+	}
+	contentHash := func(doc schema.Document) (string, error) {
+		sum := sha256.Sum256([]byte(doc.PageContent))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableNames[0],
+		cloudsql.WithIDGenerator(contentHash), cloudsql.WithMetadataJSONColumn(""))
+	require.NoError(t, err)
+
+	ids, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	copyIDs, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}}, vectorstores.WithNameSpace(tableNames[1]))
+	require.NoError(t, err)
+	wantID, err := contentHash(schema.Document{PageContent: "Tokyo"})
+	require.NoError(t, err)
+	require.Equal(t, wantID, ids[0])
+	require.Equal(t, ids[0], copyIDs[0])
+	require.NotEqual(t, ids[0], ids[1])
+
+	// The same content maps to the same id, which the primary key rejects.
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.Error(t, err)
+}
+
+func TestContainerSimilaritySearchIter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "search_iter_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+		StoreMetadata:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{
+		{PageContent: "Tokyo"}, {PageContent: "Kyoto"}, {PageContent: "Paris"}, {PageContent: "Berlin"},
+	})
+	require.NoError(t, err)
+
+	seq, err := vs.SimilaritySearchIter(ctx, "Tokyo", 4)
+	require.NoError(t, err)
+	var got []string
+	seq(func(doc schema.Document, err error) bool {
+		require.NoError(t, err)
+		got = append(got, doc.PageContent)
+		return len(got) < 2
+	})
+	require.Len(t, got, 2)
+	require.Equal(t, "Tokyo", got[0])
+	// Stopping early closes the rows, returning the connection to the pool.
+	require.Zero(t, engine.Pool.Stat().AcquiredConns())
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 4)
+	require.NoError(t, err)
+	var all []string
+	seq(func(doc schema.Document, err error) bool {
+		require.NoError(t, err)
+		all = append(all, doc.PageContent)
+		return true
+	})
+	require.Len(t, all, len(docs))
+	for i, doc := range docs {
+		require.Equal(t, doc.PageContent, all[i])
+	}
+}
+
+func TestContainerEmbeddingDimension(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "embedding_dimension_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+
+	// The dimension is detected from the vector(3) column.
+	_, err = vs.AddVectors(ctx, [][]float32{{1, 0, 0, 0}}, []schema.Document{{PageContent: "Tokyo"}})
+	require.ErrorIs(t, err, cloudsql.ErrEmbeddingDimensionMismatch)
+	require.ErrorContains(t, err, "embedding dimension 4 does not match column dimension 3")
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+}
+
+func TestContainerReadAfterWrite(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "read_after_write_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("read_after_write_index", "hnsw", cloudsql.CosineDistance{}, []string{},
+		cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "read_after_write_index", true))
+
+	for _, content := range []string{"Tokyo", "Kyoto", "Osaka"} {
+		_, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: content}})
+		require.NoError(t, err)
+		docs, err := vs.SimilaritySearch(ctx, content, 1)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, content, docs[0].PageContent)
+	}
+}
+
+func TestContainerEFSearch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "ef_search_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithEFSearch(100))
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("ef_search_index", "hnsw", cloudsql.CosineDistance{}, []string{},
+		cloudsql.HNSWOptions{M: 4, EfConstruction: 16})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "ef_search_index", false))
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+}
+
+func TestContainerProbes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "probes_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithProbes(2))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	idx := vs.NewBaseIndex("probes_index", "ivfflat", cloudsql.CosineDistance{}, []string{}, cloudsql.IVFFlatOptions{Lists: 2})
+	require.NoError(t, vs.ApplyVectorIndex(ctx, idx, "probes_index", false))
+
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "Tokyo", docs[0].PageContent)
+}
+
+func TestContainerSearchTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "timeout_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+
+	// The filter makes the query sleep well past the search timeout.
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1,
+		vectorstores.WithFilters("pg_sleep(5) IS NOT NULL"),
+		vectorstores.WithTimeout(100*time.Millisecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestContainerPoolAcquireTimeout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "pool_acquire_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	config, err := pgxpool.ParseConfig(preCheckEnvSetting(t))
+	require.NoError(t, err)
+	config.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+	smallEngine, err := cloudsqlutil.NewPostgresEngine(ctx, cloudsqlutil.WithPool(pool))
+	require.NoError(t, err)
+	vs, err := cloudsql.NewVectorStore(smallEngine, fakeEmbedder{}, tableName,
+		cloudsql.WithPoolAcquireTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+
+	// Holding the only connection makes the search wait for the pool.
+	conn, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	_, err = vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.ErrorIs(t, err, cloudsql.ErrPoolExhausted)
+	require.ErrorContains(t, err, "connection pool exhausted")
+
+	conn.Release()
+	docs, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+}
+
+func TestContainerExportAll(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "export_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	texts := []string{"Tokyo", "Kyoto", "Paris", "Berlin", "Madrid"}
+	docs := make([]schema.Document, len(texts))
+	for i, text := range texts {
+		docs[i] = schema.Document{PageContent: text, Metadata: map[string]any{"rank": i}}
+	}
+	ids, err := vs.AddDocuments(ctx, docs)
+	require.NoError(t, err)
+
+	seq, err := vs.ExportAll(ctx, 2)
+	require.NoError(t, err)
+	exported := map[string]schema.Document{}
+	seq(func(doc schema.Document, err error) bool {
+		require.NoError(t, err)
+		exported[doc.Metadata["id"].(string)] = doc
+		return true
+	})
+	require.Len(t, exported, len(texts))
+	for i, id := range ids {
+		doc, ok := exported[id]
+		require.True(t, ok)
+		require.Equal(t, texts[i], doc.PageContent)
+		require.InDelta(t, float64(i), doc.Metadata["rank"], 0)
+		want, err := fakeEmbedder{}.EmbedQuery(ctx, texts[i])
+		require.NoError(t, err)
+		require.Equal(t, want, doc.Metadata[cloudsql.EmbeddingMetadataKey])
+	}
+}
+
+func TestContainerDeduplicate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "deduplicate_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName, cloudsql.WithDeduplicate())
+	require.NoError(t, err)
+
+	first, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	second, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}, {PageContent: "Kyoto"}, {PageContent: "Kyoto"}})
+	require.NoError(t, err)
+	require.Len(t, second, 3)
+	require.Equal(t, first[0], second[0])
+	require.NotEqual(t, first[0], second[1])
+	require.Equal(t, second[1], second[2])
+
+	var count int
+	err = engine.Pool.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %q", tableName)).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestContainerDeduplicateByteaContent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	_, err := engine.Pool.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS vector`)
+	require.NoError(t, err)
+	_, err = engine.Pool.Exec(ctx, `DROP TABLE IF EXISTS "deduplicate_bytea_table";
+		CREATE TABLE "deduplicate_bytea_table" (
+			langchain_id UUID PRIMARY KEY,
+			content BYTEA NOT NULL,
+			embedding vector(3) NOT NULL,
+			langchain_metadata JSON
+		)`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), `DROP TABLE IF EXISTS "deduplicate_bytea_table"`)
+		require.NoError(t, err)
+	})
+	var storedID string
+	err = engine.Pool.QueryRow(ctx, `INSERT INTO "deduplicate_bytea_table" VALUES
+		(gen_random_uuid(), convert_to('Tokyo', 'UTF8'), '[1,0,0]', '{}') RETURNING langchain_id::text`).Scan(&storedID)
+	require.NoError(t, err)
+
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, "deduplicate_bytea_table", cloudsql.WithDeduplicate())
+	require.NoError(t, err)
+	ids, err := vs.AddDocuments(ctx, []schema.Document{{PageContent: "Tokyo"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{storedID}, ids)
+}
+
+func TestContainerConcurrentUse(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := setEngineWithImage(t)
+	tableName := "concurrent_table"
+	err := engine.InitVectorstoreTable(ctx, cloudsqlutil.VectorstoreTableOptions{
+		TableName:         tableName,
+		VectorSize:        testVectorSize,
+		OverwriteExisting: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := engine.Pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %q", tableName))
+		require.NoError(t, err)
+	})
+	vs, err := cloudsql.NewVectorStore(engine, fakeEmbedder{}, tableName)
+	require.NoError(t, err)
+	// The goroutines share the same documents and metadata.
+	docs := []schema.Document{{PageContent: "Tokyo", Metadata: map[string]any{"country": "Japan"}}}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := vs.AddDocuments(ctx, docs)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := vs.SimilaritySearch(ctx, "Tokyo", 1)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	results, err := vs.SimilaritySearch(ctx, "Tokyo", 2*workers)
+	require.NoError(t, err)
+	require.Len(t, results, workers)
+	require.Equal(t, map[string]any{"country": "Japan"}, docs[0].Metadata)
+}
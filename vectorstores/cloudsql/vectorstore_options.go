@@ -2,8 +2,10 @@ package cloudsql
 
 import (
 	"errors"
+	"time"
 
 	"github.com/averikitsch/langchaingo/embeddings"
+	"github.com/averikitsch/langchaingo/schema"
 	"github.com/averikitsch/langchaingo/util/cloudsqlutil"
 	"github.com/averikitsch/langchaingo/vectorstores"
 )
@@ -49,6 +51,15 @@ func WithContentColumn(contentColumn string) VectorStoreOption {
 	}
 }
 
+// WithContentCast sets the type the content value is cast to when documents
+// are added, such as "citext" for a citext or domain typed content column.
+// The content value is not cast by default.
+func WithContentCast(cast string) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.contentCast = cast
+	}
+}
+
 // WithEmbeddingColumn sets the EmbeddingColumn field.
 func WithEmbeddingColumn(embeddingColumn string) VectorStoreOption {
 	return func(v *VectorStore) {
@@ -56,6 +67,15 @@ func WithEmbeddingColumn(embeddingColumn string) VectorStoreOption {
 	}
 }
 
+// WithEmbeddingDimension sets the dimension embeddings must have to be added
+// to the store. By default it is detected from the embedding column on the
+// first add.
+func WithEmbeddingDimension(dimension int) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.embeddingDimension = dimension
+	}
+}
+
 // WithMetadataColumns sets the VectorStore's MetadataColumns field.
 func WithMetadataColumns(metadataColumns []string) VectorStoreOption {
 	return func(v *VectorStore) {
@@ -63,6 +83,35 @@ func WithMetadataColumns(metadataColumns []string) VectorStoreOption {
 	}
 }
 
+// WithTenantColumn sets the column that isolates tenants sharing the table.
+// Every call must then name its tenant with vectorstores.WithNameSpace;
+// documents are added with that tenant and searches only return its documents.
+func WithTenantColumn(column string) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.tenantColumn = column
+	}
+}
+
+// WithSparseEmbeddingColumn sets the pgvector sparsevec column, of the given
+// dimensions, used by AddSparseVectors and SparseSimilaritySearch. It needs
+// pgvector 0.7.0 or later.
+func WithSparseEmbeddingColumn(column string, dimensions int) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.sparseEmbeddingColumn = column
+		v.sparseDimensions = dimensions
+	}
+}
+
+// WithIDGenerator sets how AddDocuments and AddVectors derive the id of a
+// document whose metadata has no string "id" value, for example from a hash
+// of its content so that identical documents share an id. The id must be
+// valid for the id column. Ids default to random UUIDs.
+func WithIDGenerator(generator func(doc schema.Document) (string, error)) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.idGenerator = generator
+	}
+}
+
 // WithK sets the number of Documents to return from the VectorStore.
 func WithK(k int) VectorStoreOption {
 	return func(v *VectorStore) {
@@ -77,6 +126,58 @@ func WithDistanceStrategy(distanceStrategy distanceStrategy) VectorStoreOption {
 	}
 }
 
+// WithDeduplicate makes AddDocuments skip documents whose content is already
+// stored in the target table, or repeated earlier in the same call, returning
+// the id of the stored or earlier document for them. Contents are compared
+// for equality, so an index on the content column speeds up the lookup of
+// large tables. Unlike the vectorstores.WithDeduplicater option, it needs no
+// callback. AddVectors is unaffected.
+func WithDeduplicate() VectorStoreOption {
+	return func(v *VectorStore) {
+		v.deduplicate = true
+	}
+}
+
+// WithPoolAcquireTimeout bounds how long a search waits for a connection
+// when the engine pool is exhausted. A search that gets no connection in time
+// fails with ErrPoolExhausted instead of blocking until one frees up or its
+// context is done.
+func WithPoolAcquireTimeout(timeout time.Duration) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.poolAcquireTimeout = timeout
+	}
+}
+
+// WithEFSearch sets hnsw.ef_search, the size of the candidate list of HNSW
+// index scans, for the store's searches, trading latency for recall. Each
+// search then runs in its own transaction that sets it with SET LOCAL. The
+// server default, 40, is used when it is not set.
+func WithEFSearch(efSearch int) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.efSearch = efSearch
+	}
+}
+
+// WithProbes sets ivfflat.probes, the number of lists IVFFlat index scans
+// visit, for the store's searches, trading latency for recall. Each search
+// then runs in its own transaction that sets it with SET LOCAL. The server
+// default, 1, is used when it is not set.
+func WithProbes(probes int) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.probes = probes
+	}
+}
+
+// WithTransactional sets whether AddDocuments and AddVectors insert all
+// documents in a single transaction, so that a failing document leaves none
+// of them stored. It defaults to true; disable it to trade atomicity for
+// throughput.
+func WithTransactional(transactional bool) VectorStoreOption {
+	return func(v *VectorStore) {
+		v.transactional = transactional
+	}
+}
+
 // VectorStoreOption applies the given VectorStore options to the
 // VectorStore with a cloudsql Engine.
 func applyCloudSQLVectorStoreOptions(engine cloudsqlutil.PostgresEngine,
@@ -88,9 +189,6 @@ func applyCloudSQLVectorStoreOptions(engine cloudsqlutil.PostgresEngine,
 	if engine.Pool == nil {
 		return VectorStore{}, errors.New("missing vector store engine")
 	}
-	if embedder == nil {
-		return VectorStore{}, errors.New("missing vector store embeder")
-	}
 	if tableName == "" {
 		return VectorStore{}, errors.New("missing vector store table name")
 	}
@@ -108,10 +206,31 @@ func applyCloudSQLVectorStoreOptions(engine cloudsqlutil.PostgresEngine,
 		k:                  defaultK,
 		distanceStrategy:   defaultDistanceStrategy,
 		metadataColumns:    []string{},
+		transactional:      true,
+		idGenerator:        newUUID,
+		columnDimension:    &dimensionCache{},
 	}
 	for _, opt := range opts {
 		opt(vs)
 	}
+	if vs.idGenerator == nil {
+		vs.idGenerator = newUUID
+	}
+	if vs.efSearch < 0 {
+		return VectorStore{}, errors.New("ef_search must not be negative")
+	}
+	if vs.probes < 0 {
+		return VectorStore{}, errors.New("probes must not be negative")
+	}
+	if vs.poolAcquireTimeout < 0 {
+		return VectorStore{}, errors.New("pool acquire timeout must not be negative")
+	}
+	if vs.embeddingDimension < 0 {
+		return VectorStore{}, errors.New("embedding dimension must not be negative")
+	}
+	if vs.sparseEmbeddingColumn != "" && vs.sparseDimensions <= 0 {
+		return VectorStore{}, errors.New("sparse embedding column dimensions must be greater than zero")
+	}
 
 	return *vs, nil
 }
@@ -2,6 +2,7 @@ package vectorstores
 
 import (
 	"context"
+	"time"
 
 	"github.com/averikitsch/langchaingo/embeddings"
 	"github.com/averikitsch/langchaingo/schema"
@@ -17,6 +18,7 @@ type Options struct {
 	Filters        any
 	Embedder       embeddings.Embedder
 	Deduplicater   func(context.Context, schema.Document) bool
+	Timeout        time.Duration
 }
 
 // WithNameSpace returns an Option for setting the name space.
@@ -59,3 +61,12 @@ func WithDeduplicater(fn func(ctx context.Context, doc schema.Document) bool) Op
 		o.Deduplicater = fn
 	}
 }
+
+// WithTimeout returns an Option for bounding how long a similarity search may
+// take, independently of the deadline of the caller's context. Stores that do
+// not support it ignore it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}